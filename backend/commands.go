@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"tacohut/handlers"
+	"tacohut/store"
+)
+
+// runCommand runs a one-off admin command instead of the server and
+// returns the process exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "rebuild", "verify":
+		return runRebuild(args[0], args[1:])
+	case "migrate":
+		return runMigrate(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q (available: rebuild, verify, migrate)\n", args[0])
+		return 2
+	}
+}
+
+// runRebuild recomputes analytics rollups for a date range. "verify" is the
+// dry-run form: it only prints the drift report.
+func runRebuild(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fromFlag := fs.String("from", "", "first day to rebuild (YYYY-MM-DD)")
+	toFlag := fs.String("to", "", "last day to rebuild (YYYY-MM-DD), defaults to from")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *toFlag == "" {
+		*toFlag = *fromFlag
+	}
+
+	calendar, err := handlers.LoadCalendar()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	from, err := calendar.ParseDay(*fromFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid -from date, use YYYY-MM-DD")
+		return 2
+	}
+	to, err := calendar.ParseDay(*toFlag)
+	if err != nil || to.Before(from) {
+		fmt.Fprintln(os.Stderr, "invalid -to date, use YYYY-MM-DD on or after -from")
+		return 2
+	}
+	_, toEnd := calendar.Range(to, "daily")
+
+	db, err := openStore(os.Getenv("STORE_BACKEND"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+		return 1
+	}
+	defer db.Close(context.Background())
+
+	if err := migrateStore(context.Background(), db); err != nil {
+		fmt.Fprintf(os.Stderr, "Error migrating store: %v\n", err)
+		return 1
+	}
+
+	report, err := handlers.New(db, calendar).RebuildAnalytics(context.Background(), from, toEnd, name == "verify")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error rebuilding analytics: %v\n", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+
+	if name == "verify" && len(report.Drift) > 0 {
+		return 3
+	}
+	return 0
+}
+
+// runMigrate applies pending schema migrations, or with -status lists which
+// ones have been applied without changing anything.
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	status := fs.Bool("status", false, "list applied and pending migrations only")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	db, err := openStore(os.Getenv("STORE_BACKEND"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+		return 1
+	}
+	defer db.Close(context.Background())
+
+	migrator, ok := db.(store.Migrator)
+	if !ok {
+		fmt.Println("This store has no schema to migrate")
+		return 0
+	}
+
+	if !*status {
+		if err := migrateStore(context.Background(), db); err != nil {
+			fmt.Fprintf(os.Stderr, "Error migrating store: %v\n", err)
+			return 1
+		}
+	}
+
+	applied, err := migrator.AppliedMigrations(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading migrations: %v\n", err)
+		return 1
+	}
+	appliedAt := make(map[int]time.Time, len(applied))
+	for _, a := range applied {
+		appliedAt[a.Version] = a.AppliedAt
+	}
+
+	for _, m := range store.Migrations {
+		state := "pending"
+		if t, ok := appliedAt[m.Version]; ok {
+			state = "applied " + t.Format(time.RFC3339)
+		}
+		fmt.Printf("%4d  %-28s  %s\n", m.Version, state, m.Description)
+	}
+	return 0
+}
@@ -0,0 +1,215 @@
+// Package forecast predicts the next values of a seasonal series, such as
+// daily sales with a weekly pattern.
+package forecast
+
+import (
+	"math"
+)
+
+// Methods, from most to least history needed.
+const (
+	HoltWinters     = "holt-winters"     // at least two seasons
+	SeasonalAverage = "seasonal-average" // at least one season
+	Mean            = "mean"             // anything shorter
+)
+
+// seasonalAverageSeasons is how many past seasons SeasonalAverage averages.
+const seasonalAverageSeasons = 4
+
+// z-scores of the two-sided 80% and 95% normal intervals.
+const (
+	z80 = 1.2816
+	z95 = 1.9600
+)
+
+// Point is one forecast value with its prediction intervals. Values are
+// clamped at zero, since neither sales nor quantities go negative.
+type Point struct {
+	Value   float64
+	Lower80 float64
+	Upper80 float64
+	Lower95 float64
+	Upper95 float64
+}
+
+// Result is a forecast and how it was made. Alpha, Beta and Gamma are the
+// fitted level, trend and season smoothing factors of HoltWinters.
+type Result struct {
+	Method string
+	Alpha  float64
+	Beta   float64
+	Gamma  float64
+	Sigma  float64 // standard deviation of the one-step fit errors
+	Points []Point
+}
+
+// Seasonal forecasts horizon values after series, which has one value per
+// step and repeats every season steps. It picks the method by how much
+// history there is.
+func Seasonal(series []float64, season, horizon int) Result {
+	switch {
+	case season > 1 && len(series) >= 2*season:
+		return holtWinters(series, season, horizon)
+	case season > 1 && len(series) >= season:
+		return seasonalAverage(series, season, horizon)
+	default:
+		return mean(series, horizon)
+	}
+}
+
+// Smoothing factors tried when fitting Holt-Winters. Trend is kept small
+// so two weeks ahead does not run away on a good or bad week.
+var (
+	alphas = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7}
+	betas  = []float64{0, 0.02, 0.05, 0.1}
+	gammas = []float64{0.05, 0.1, 0.2, 0.3, 0.5}
+)
+
+// holtWinters fits additive Holt-Winters by grid search over the smoothing
+// factors, minimising the one-step squared error.
+func holtWinters(series []float64, season, horizon int) Result {
+	best := Result{Method: HoltWinters, Sigma: math.Inf(1)}
+	var bestFit hwState
+	for _, alpha := range alphas {
+		for _, beta := range betas {
+			for _, gamma := range gammas {
+				fit, sse, n := fitHoltWinters(series, season, alpha, beta, gamma)
+				sigma := math.Sqrt(sse / float64(n))
+				if sigma < best.Sigma {
+					best.Alpha, best.Beta, best.Gamma, best.Sigma = alpha, beta, gamma, sigma
+					bestFit = fit
+				}
+			}
+		}
+	}
+
+	// The h-step variance of additive Holt-Winters grows with every
+	// smoothing factor; see Hyndman et al., Forecasting with Exponential
+	// Smoothing, table 6.1.
+	variance := 0.0
+	last := len(series) - 1
+	for h := 1; h <= horizon; h++ {
+		if h > 1 {
+			j := float64(h - 1)
+			c := best.Alpha * (1 + j*best.Beta)
+			if (h-1)%season == 0 {
+				c += best.Gamma
+			}
+			variance += c * c
+		}
+		value := bestFit.level + float64(h)*bestFit.trend + bestFit.seasonal[(last+h)%season]
+		best.Points = append(best.Points, point(value, best.Sigma*math.Sqrt(1+variance)))
+	}
+	return best
+}
+
+type hwState struct {
+	level, trend float64
+	seasonal     []float64 // by step modulo season
+}
+
+// fitHoltWinters runs the recursions over series, starting from the first
+// season, and returns the final state with the squared one-step errors of
+// the remaining steps.
+func fitHoltWinters(series []float64, season int, alpha, beta, gamma float64) (hwState, float64, int) {
+	first := average(series[:season])
+	second := average(series[season : 2*season])
+
+	state := hwState{
+		level:    first,
+		trend:    (second - first) / float64(season),
+		seasonal: make([]float64, season),
+	}
+	for i := 0; i < season; i++ {
+		state.seasonal[i] = series[i] - first
+	}
+	// The level is of the first season's middle; move it to its end.
+	state.level += state.trend * float64(season-1) / 2
+
+	sse := 0.0
+	for t := season; t < len(series); t++ {
+		s := state.seasonal[t%season]
+		predicted := state.level + state.trend + s
+		err := series[t] - predicted
+		sse += err * err
+
+		level := alpha*(series[t]-s) + (1-alpha)*(state.level+state.trend)
+		state.trend = beta*(level-state.level) + (1-beta)*state.trend
+		state.level = level
+		state.seasonal[t%season] = gamma*(series[t]-level) + (1-gamma)*s
+	}
+	return state, sse, len(series) - season
+}
+
+// seasonalAverage predicts each step as the mean of the same step in up to
+// seasonalAverageSeasons past seasons.
+func seasonalAverage(series []float64, season, horizon int) Result {
+	phaseMean := make([]float64, season)
+	phaseCount := make([]int, season)
+	start := len(series) - seasonalAverageSeasons*season
+	if start < 0 {
+		start = 0
+	}
+	for t := start; t < len(series); t++ {
+		phaseMean[t%season] += series[t]
+		phaseCount[t%season]++
+	}
+	for i := range phaseMean {
+		if phaseCount[i] > 0 {
+			phaseMean[i] /= float64(phaseCount[i])
+		}
+	}
+
+	sse := 0.0
+	for t := start; t < len(series); t++ {
+		err := series[t] - phaseMean[t%season]
+		sse += err * err
+	}
+	sigma := math.Sqrt(sse / float64(len(series)-start))
+
+	result := Result{Method: SeasonalAverage, Sigma: sigma}
+	last := len(series) - 1
+	for h := 1; h <= horizon; h++ {
+		result.Points = append(result.Points, point(phaseMean[(last+h)%season], sigma))
+	}
+	return result
+}
+
+func mean(series []float64, horizon int) Result {
+	m := average(series)
+	sse := 0.0
+	for _, v := range series {
+		sse += (v - m) * (v - m)
+	}
+	sigma := 0.0
+	if len(series) > 0 {
+		sigma = math.Sqrt(sse / float64(len(series)))
+	}
+
+	result := Result{Method: Mean, Sigma: sigma}
+	for h := 1; h <= horizon; h++ {
+		result.Points = append(result.Points, point(m, sigma))
+	}
+	return result
+}
+
+func point(value, sigma float64) Point {
+	return Point{
+		Value:   math.Max(value, 0),
+		Lower80: math.Max(value-z80*sigma, 0),
+		Upper80: math.Max(value+z80*sigma, 0),
+		Lower95: math.Max(value-z95*sigma, 0),
+		Upper95: math.Max(value+z95*sigma, 0),
+	}
+}
+
+func average(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
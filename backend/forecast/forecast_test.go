@@ -0,0 +1,137 @@
+package forecast
+
+import (
+	"math"
+	"testing"
+)
+
+const tolerance = 1e-6
+
+func repeat(season []float64, times int) []float64 {
+	var series []float64
+	for i := 0; i < times; i++ {
+		series = append(series, season...)
+	}
+	return series
+}
+
+func TestSeasonalConstant(t *testing.T) {
+	series := repeat([]float64{100}, 28)
+	result := Seasonal(series, 7, 14)
+
+	if result.Method != HoltWinters {
+		t.Errorf("Method = %s, want %s", result.Method, HoltWinters)
+	}
+	if result.Sigma > tolerance {
+		t.Errorf("Sigma = %v, want 0", result.Sigma)
+	}
+	if len(result.Points) != 14 {
+		t.Fatalf("%d points, want 14", len(result.Points))
+	}
+	for h, p := range result.Points {
+		if math.Abs(p.Value-100) > tolerance || math.Abs(p.Upper95-p.Lower95) > tolerance {
+			t.Errorf("step %d = %+v, want 100 with no spread", h+1, p)
+		}
+	}
+}
+
+func TestSeasonalWeeklyPattern(t *testing.T) {
+	week := []float64{10, 20, 30, 40, 50, 60, 70}
+	series := append(repeat(week, 4), week[:3]...)
+	result := Seasonal(series, 7, 14)
+
+	if result.Method != HoltWinters {
+		t.Errorf("Method = %s, want %s", result.Method, HoltWinters)
+	}
+	for h, p := range result.Points {
+		want := week[(len(series)+h)%7]
+		if math.Abs(p.Value-want) > tolerance {
+			t.Errorf("step %d = %v, want %v", h+1, p.Value, want)
+		}
+	}
+}
+
+func TestSeasonalShortSeries(t *testing.T) {
+	week := []float64{10, 20, 30, 40, 50, 60, 70}
+
+	t.Run("one season", func(t *testing.T) {
+		series := append(append([]float64(nil), week...), 12, 22, 32)
+		result := Seasonal(series, 7, 7)
+		if result.Method != SeasonalAverage {
+			t.Fatalf("Method = %s, want %s", result.Method, SeasonalAverage)
+		}
+		// The next step is the fourth weekday, seen once as 40.
+		if math.Abs(result.Points[0].Value-40) > tolerance {
+			t.Errorf("step 1 = %v, want 40", result.Points[0].Value)
+		}
+		// The step after repeats the first weekday, seen as 10 and 12.
+		if math.Abs(result.Points[4].Value-11) > tolerance {
+			t.Errorf("step 5 = %v, want 11", result.Points[4].Value)
+		}
+	})
+
+	t.Run("under a season", func(t *testing.T) {
+		result := Seasonal([]float64{10, 20, 30}, 7, 3)
+		if result.Method != Mean {
+			t.Fatalf("Method = %s, want %s", result.Method, Mean)
+		}
+		for h, p := range result.Points {
+			if math.Abs(p.Value-20) > tolerance {
+				t.Errorf("step %d = %v, want 20", h+1, p.Value)
+			}
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		result := Seasonal(nil, 7, 3)
+		if result.Method != Mean || len(result.Points) != 3 || result.Points[0] != (Point{}) {
+			t.Errorf("Seasonal(nil) = %+v, want three zero points", result)
+		}
+	})
+}
+
+func TestSeasonalIntervalsWiden(t *testing.T) {
+	week := []float64{900, 1000, 1100, 1200, 1300, 1500, 1400}
+	var series []float64
+	for i := 0; i < 8*7; i++ {
+		// A fixed, uneven wobble so the fit has errors to size intervals.
+		noise := float64((i*37)%11-5) * 15
+		series = append(series, week[i%7]+noise)
+	}
+	result := Seasonal(series, 7, 21)
+
+	if result.Method != HoltWinters {
+		t.Fatalf("Method = %s, want %s", result.Method, HoltWinters)
+	}
+	if result.Sigma <= 0 {
+		t.Fatalf("Sigma = %v, want > 0", result.Sigma)
+	}
+
+	previous80, previous95 := 0.0, 0.0
+	for h, p := range result.Points {
+		width80, width95 := p.Upper80-p.Lower80, p.Upper95-p.Lower95
+		if width80 < previous80-tolerance || width95 < previous95-tolerance {
+			t.Errorf("step %d: intervals narrowed to %v/%v from %v/%v", h+1, width80, width95, previous80, previous95)
+		}
+		if width95 <= width80 {
+			t.Errorf("step %d: 95%% interval %v not wider than 80%% interval %v", h+1, width95, width80)
+		}
+		if p.Lower95 > p.Value || p.Value > p.Upper95 {
+			t.Errorf("step %d: %v outside its interval [%v, %v]", h+1, p.Value, p.Lower95, p.Upper95)
+		}
+		previous80, previous95 = width80, width95
+	}
+
+	first, last := result.Points[0], result.Points[len(result.Points)-1]
+	if last.Upper95-last.Lower95 <= first.Upper95-first.Lower95 {
+		t.Errorf("interval at step 21 (%v) is not wider than at step 1 (%v)",
+			last.Upper95-last.Lower95, first.Upper95-first.Lower95)
+	}
+}
+
+func TestPointClampsAtZero(t *testing.T) {
+	p := point(5, 10)
+	if p.Lower80 != 0 || p.Lower95 != 0 || p.Value != 5 {
+		t.Errorf("point(5, 10) = %+v, want lower bounds clamped at 0", p)
+	}
+}
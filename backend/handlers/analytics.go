@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"tacohut/models"
+	"tacohut/store"
+)
+
+// maxSeriesLength caps how many rollups one range request may return.
+const maxSeriesLength = 1000
+
+var errRangeTooLong = errors.New("range too long")
+
+// AnalyticsRange is a window of rollups of one period type. Series has one
+// entry per period overlapping [From, To], including empty ones, and
+// Summary merges them.
+type AnalyticsRange struct {
+	Period  string                    `json:"period"`
+	From    time.Time                 `json:"from"`
+	To      time.Time                 `json:"to"`
+	Series  []models.AnalyticsSummary `json:"series"`
+	Summary models.AnalyticsSummary   `json:"summary"`
+}
+
+// GetAnalytics serves GET /api/analytics?period=weekly.
+//
+// With date (YYYY-MM-DD, default today) it returns the rollup of that
+// period containing the date. With from and to it returns an
+// AnalyticsRange instead, e.g. period=weekly&from=...&to=... for "last 6
+// weeks".
+func (h *Handler) GetAnalytics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	period := r.URL.Query().Get("period") // one of the configured rollups
+	dateParam := r.URL.Query().Get("date")
+
+	if period == "" {
+		http.Error(w, "Period parameter is required ("+strings.Join(h.calendar.PeriodNames(), ", ")+")", http.StatusBadRequest)
+		return
+	}
+
+	if !h.calendar.Rollup(period) {
+		http.Error(w, "Invalid period. Use: "+strings.Join(h.calendar.PeriodNames(), ", "), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if r.URL.Query().Has("from") || r.URL.Query().Has("to") {
+		from, to, err := h.parseDateRange(r)
+		if err != nil {
+			http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := h.AnalyticsBetween(ctx, period, from, to)
+		if errors.Is(err, errRangeTooLong) {
+			http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("Error fetching %s analytics range: %v", period, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		writeAnalytics(w, result)
+		return
+	}
+
+	var targetDate time.Time
+	var err error
+
+	if dateParam == "" {
+		targetDate = time.Now()
+	} else {
+		targetDate, err = h.calendar.ParseDay(dateParam)
+		if err != nil {
+			http.Error(w, "Invalid date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	startDate, endDate := h.calculateDateRange(targetDate, period)
+
+	analytics, err := h.store.Periods().FindPeriod(ctx, period, startDate, endDate)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("No %s analytics found for the specified date", period), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching %s analytics: %v", period, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeAnalytics(w, analytics)
+}
+
+// AnalyticsBetween builds the series of period rollups overlapping
+// [from, to] and their merged summary.
+func (h *Handler) AnalyticsBetween(ctx context.Context, period string, from, to time.Time) (AnalyticsRange, error) {
+	firstStart, _ := h.calculateDateRange(from, period)
+
+	stored, err := h.store.Periods().PeriodsBetween(ctx, period, firstStart, to)
+	if err != nil {
+		return AnalyticsRange{}, err
+	}
+	byStart := make(map[time.Time]models.AnalyticsSummary, len(stored))
+	for _, summary := range stored {
+		byStart[summary.StartDate.UTC()] = summary
+	}
+
+	result := AnalyticsRange{Period: period, From: from, To: to}
+	for startDate, endDate := h.calculateDateRange(from, period); !startDate.After(to); startDate, endDate = h.calculateDateRange(endDate.Add(time.Nanosecond), period) {
+		if len(result.Series) == maxSeriesLength {
+			return AnalyticsRange{}, fmt.Errorf("%w: covers more than %d %s periods", errRangeTooLong, maxSeriesLength, period)
+		}
+
+		summary, ok := byStart[startDate.UTC()]
+		if !ok {
+			summary = emptySummary(period, startDate, endDate)
+		}
+		result.Series = append(result.Series, summary)
+	}
+
+	result.Summary = mergeSummaries(period, result.Series)
+	return result, nil
+}
+
+func emptySummary(period string, startDate, endDate time.Time) models.AnalyticsSummary {
+	return models.AnalyticsSummary{
+		Period:            period,
+		StartDate:         startDate,
+		EndDate:           endDate,
+		ItemsSold:         make(map[string]int),
+		Items:             make(map[string]models.ItemStats),
+		PaymentMethods:    make(map[string]models.Money),
+		TotalSales:        models.NewMoney(0),
+		CostOfGoods:       models.NewMoney(0),
+		OperatingExpenses: models.NewMoney(0),
+		ExpenseCategories: make(map[string]models.Money),
+		TotalExpenses:     models.NewMoney(0),
+		GrossProfit:       models.NewMoney(0),
+		NetProfit:         models.NewMoney(0),
+	}
+}
+
+// mergeSummaries adds up consecutive rollups into one spanning all of them.
+func mergeSummaries(period string, series []models.AnalyticsSummary) models.AnalyticsSummary {
+	if len(series) == 0 {
+		return emptySummary(period, time.Time{}, time.Time{})
+	}
+
+	merged := emptySummary(period, series[0].StartDate, series[len(series)-1].EndDate)
+	for _, summary := range series {
+		for item, quantity := range summary.ItemsSold {
+			merged.ItemsSold[item] += quantity
+		}
+		for key, stats := range summary.Items {
+			total := merged.Items[key]
+			total.Name = stats.Name
+			total.Quantity += stats.Quantity
+			total.Revenue = total.Revenue.Add(stats.Revenue)
+			total.Cost = total.Cost.Add(stats.Cost)
+			total.Margin = total.Revenue.Sub(total.Cost)
+			merged.Items[key] = total
+		}
+		for method, amount := range summary.PaymentMethods {
+			merged.PaymentMethods[method] = merged.PaymentMethods[method].Add(amount)
+		}
+		merged.TotalSales = merged.TotalSales.Add(summary.TotalSales)
+		for category, amount := range summary.ExpenseCategories {
+			merged.ExpenseCategories[category] = merged.ExpenseCategories[category].Add(amount)
+		}
+		merged.TotalExpenses = merged.TotalExpenses.Add(summary.TotalExpenses)
+		merged.CostOfGoods = merged.CostOfGoods.Add(summary.CostOfGoods)
+		merged.TransactionCount += summary.TransactionCount
+		if summary.LastUpdated.After(merged.LastUpdated) {
+			merged.LastUpdated = summary.LastUpdated
+		}
+	}
+	merged.OperatingExpenses = merged.TotalExpenses.Sub(merged.CostOfGoods)
+	merged.GrossProfit = merged.TotalSales.Sub(merged.CostOfGoods)
+	merged.NetProfit = merged.TotalSales.Sub(merged.TotalExpenses)
+	return merged
+}
+
+// parseReportRange reads the window a report covers: from and to as whole
+// business days when given, otherwise the period containing date (default
+// today).
+func (h *Handler) parseReportRange(r *http.Request, period string) (time.Time, time.Time, error) {
+	if r.URL.Query().Has("from") || r.URL.Query().Has("to") {
+		return h.parseDateRange(r)
+	}
+
+	date := time.Now()
+	if dateParam := r.URL.Query().Get("date"); dateParam != "" {
+		var err error
+		date, err = h.calendar.ParseDay(dateParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid date, use YYYY-MM-DD")
+		}
+	}
+	from, to := h.calculateDateRange(date, period)
+	return from, to, nil
+}
+
+// recentDays is the window of reports over raw sales when no from/to is
+// given.
+const recentDays = 28
+
+// parseRecentRange reads from/to as whole business days, defaulting to the
+// last recentDays days including today.
+func (h *Handler) parseRecentRange(r *http.Request) (time.Time, time.Time, error) {
+	if r.URL.Query().Has("from") || r.URL.Query().Has("to") {
+		return h.parseDateRange(r)
+	}
+	today, end := h.calculateDateRange(time.Now(), "daily")
+	return today.AddDate(0, 0, 1-recentDays), end, nil
+}
+
+func writeAnalytics(w http.ResponseWriter, data interface{}) {
+	response := map[string]interface{}{
+		"status": "success",
+		"data":   data,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"tacohut/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// saleTotalTolerance is how many cents a sale total may differ from
+	// its items before it is flagged, so rounding and small discounts
+	// stay quiet. At saleTotalCritical of the items' value it is critical.
+	saleTotalTolerance = 100
+	saleTotalCritical  = 0.25
+
+	// A finished day is flagged when its sales fall under these shares of
+	// its weekday baseline: the median of the same weekday over the last
+	// baselineWeeks weeks, from at least minBaselineDays days with data.
+	lowSalesWarning  = 0.5
+	lowSalesCritical = 0.25
+	baselineWeeks    = 8
+	minBaselineDays  = 3
+
+	// An expense is flagged at these multiples of its category's median
+	// over the previous expenseNormDays days, from at least
+	// minExpenseSamples expenses.
+	highExpenseWarning  = 3.0
+	highExpenseCritical = 6.0
+	expenseNormDays     = 90
+	minExpenseSamples   = 5
+
+	// anomalyScanDays is how far back a scheduled scan looks.
+	anomalyScanDays = 7
+
+	// anomalyCheckTimeout bounds the checks that follow a write.
+	anomalyCheckTimeout = 30 * time.Second
+)
+
+func saleTotalKey(id string) string   { return models.AnomalySaleTotal + ":" + id }
+func highExpenseKey(id string) string { return models.AnomalyHighExpense + ":" + id }
+func lowSalesKey(date time.Time) string {
+	return models.AnomalyLowSales + ":" + date.Format("2006-01-02")
+}
+
+func hexID(id interface{}) string {
+	if objID, ok := id.(primitive.ObjectID); ok {
+		return objID.Hex()
+	}
+	return fmt.Sprint(id)
+}
+
+// saveAnomaly stores a when flagged is true and clears the anomaly with
+// the same key otherwise, so fixing a record also clears its alert.
+func (h *Handler) saveAnomaly(ctx context.Context, key string, a models.Anomaly, flagged bool) error {
+	if !flagged {
+		return h.store.Anomalies().ResolveAnomaly(ctx, key)
+	}
+	a.Key = key
+	a.DetectedAt = time.Now()
+	return h.store.Anomalies().UpsertAnomaly(ctx, a)
+}
+
+// checkSale flags a sale whose total does not match its items. Voided
+// sales are never flagged.
+func (h *Handler) checkSale(ctx context.Context, sale models.SalesData) error {
+	a, flagged := saleTotalAnomaly(sale)
+	return h.saveAnomaly(ctx, saleTotalKey(hexID(sale.ID)), a, flagged && sale.Voided == nil)
+}
+
+func saleTotalAnomaly(sale models.SalesData) (models.Anomaly, bool) {
+	items := models.NewMoney(0)
+	for _, item := range sale.Items {
+		items = items.Add(item.Price.Mul(item.Quantity))
+	}
+	diff := sale.Total.Sub(items)
+	off := diff.Cents
+	if off < 0 {
+		off = -off
+	}
+	if off <= saleTotalTolerance {
+		return models.Anomaly{}, false
+	}
+
+	severity := models.SeverityWarning
+	if items.Cents == 0 || float64(off) >= saleTotalCritical*float64(items.Cents) {
+		severity = models.SeverityCritical
+	}
+	direction := "over"
+	if diff.Cents < 0 {
+		direction = "short"
+	}
+	return models.Anomaly{
+		Kind:       models.AnomalySaleTotal,
+		Severity:   severity,
+		Title:      "Sale total does not match its items",
+		Message:    fmt.Sprintf("Sale recorded as %s but its items add up to %s (%s %s).", sale.Total, items, models.NewMoney(off), direction),
+		Subject:    hexID(sale.ID),
+		OccurredAt: sale.RecordedAt,
+	}, true
+}
+
+// checkExpense compares an expense with the same category's expenses in
+// the expenseNormDays before it.
+func (h *Handler) checkExpense(ctx context.Context, expense models.ExpensesFetched) error {
+	key := highExpenseKey(hexID(expense.ID))
+	if expense.Voided != nil {
+		return h.saveAnomaly(ctx, key, models.Anomaly{}, false)
+	}
+
+	history, err := h.store.Expenses().ExpensesBetween(ctx, expense.TimeAdded.AddDate(0, 0, -expenseNormDays), expense.TimeAdded)
+	if err != nil {
+		return fmt.Errorf("error reading expenses: %w", err)
+	}
+	a, flagged := highExpenseAnomaly(expense, history)
+	return h.saveAnomaly(ctx, key, a, flagged)
+}
+
+// highExpenseAnomaly checks expense against those in history of the same
+// category added before it.
+func highExpenseAnomaly(expense models.ExpensesFetched, history []models.ExpensesFetched) (models.Anomaly, bool) {
+	var amounts []int64
+	for _, other := range history {
+		if other.Category != expense.Category || !other.TimeAdded.Before(expense.TimeAdded) || hexID(other.ID) == hexID(expense.ID) {
+			continue
+		}
+		amounts = append(amounts, other.Amount.Cents)
+	}
+	if len(amounts) < minExpenseSamples {
+		return models.Anomaly{}, false
+	}
+	median := medianCents(amounts)
+	if median <= 0 {
+		return models.Anomaly{}, false
+	}
+
+	ratio := float64(expense.Amount.Cents) / float64(median)
+	severity := models.SeverityWarning
+	switch {
+	case ratio >= highExpenseCritical:
+		severity = models.SeverityCritical
+	case ratio < highExpenseWarning:
+		return models.Anomaly{}, false
+	}
+	return models.Anomaly{
+		Kind:     models.AnomalyHighExpense,
+		Severity: severity,
+		Title:    "Unusually large " + expense.Category + " expense",
+		Message: fmt.Sprintf("%s for %q is %.1fx the usual %s expense (median %s over the last %d).",
+			expense.Amount, expense.Description, ratio, expense.Category, models.NewMoney(median), len(amounts)),
+		Subject:    hexID(expense.ID),
+		OccurredAt: expense.TimeAdded,
+	}, true
+}
+
+// checkDay compares the sales of the business day starting at day with
+// its weekday baseline. Days that are not over yet are left alone.
+func (h *Handler) checkDay(ctx context.Context, day time.Time) error {
+	_, end := h.calculateDateRange(day, "daily")
+	if end.After(time.Now()) {
+		return nil
+	}
+
+	days, err := h.dailyHistory(ctx, day.AddDate(0, 0, -7*baselineWeeks), end)
+	if err != nil {
+		return err
+	}
+	a, flagged := h.lowSalesAnomaly(day, days)
+	return h.saveAnomaly(ctx, lowSalesKey(day), a, flagged)
+}
+
+// lowSalesAnomaly checks day against the same weekday in earlier weeks of
+// days, as returned by dailyHistory. Weeks without a rollup are left out
+// of the baseline, so a weekday the shop is always closed is never
+// flagged.
+func (h *Handler) lowSalesAnomaly(day time.Time, days map[time.Time]models.AnalyticsSummary) (models.Anomaly, bool) {
+	var samples []int64
+	for week := 1; week <= baselineWeeks; week++ {
+		earlier := h.dayOf(day.AddDate(0, 0, -7*week).Add(time.Hour))
+		if summary, ok := days[earlier.UTC()]; ok {
+			samples = append(samples, summary.TotalSales.Cents)
+		}
+	}
+	if len(samples) < minBaselineDays {
+		return models.Anomaly{}, false
+	}
+	baseline := medianCents(samples)
+	if baseline <= 0 {
+		return models.Anomaly{}, false
+	}
+
+	sales := days[day.UTC()].TotalSales.Cents
+	share := float64(sales) / float64(baseline)
+	severity := models.SeverityWarning
+	switch {
+	case share < lowSalesCritical:
+		severity = models.SeverityCritical
+	case share >= lowSalesWarning:
+		return models.Anomaly{}, false
+	}
+	return models.Anomaly{
+		Kind:     models.AnomalyLowSales,
+		Severity: severity,
+		Title:    "Low sales on " + day.Format("Monday 2 Jan"),
+		Message: fmt.Sprintf("Sales were %s, %.0f%% of a usual %s (median %s over the last %d).",
+			models.NewMoney(sales), share*100, day.Weekday(), models.NewMoney(baseline), len(samples)),
+		Subject:    day.Format("2006-01-02"),
+		OccurredAt: day,
+	}, true
+}
+
+func medianCents(values []int64) int64 {
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// detectAfterSale runs the checks a sale write can change: the sale
+// itself and the days it was, and now is, counted on. They run in the
+// background with their own context so the response does not wait on
+// them. Failures are logged, since the write has already been committed.
+func (h *Handler) detectAfterSale(sale models.SalesData, days ...time.Time) {
+	h.inBackground(func(ctx context.Context) {
+		h.checkSaleAndDays(ctx, sale, days)
+	})
+}
+
+func (h *Handler) checkSaleAndDays(ctx context.Context, sale models.SalesData, days []time.Time) {
+	if err := h.checkSale(ctx, sale); err != nil {
+		log.Printf("Error checking sale %s for anomalies: %v", hexID(sale.ID), err)
+	}
+	checked := make(map[time.Time]bool)
+	for _, t := range append(days, sale.RecordedAt) {
+		day := h.dayOf(t)
+		if checked[day] {
+			continue
+		}
+		checked[day] = true
+		if err := h.checkDay(ctx, day); err != nil {
+			log.Printf("Error checking %s for anomalies: %v", day.Format("2006-01-02"), err)
+		}
+	}
+}
+
+// detectAfterExpense is detectAfterSale for expenses.
+func (h *Handler) detectAfterExpense(expense models.ExpensesFetched) {
+	h.inBackground(func(ctx context.Context) {
+		if err := h.checkExpense(ctx, expense); err != nil {
+			log.Printf("Error checking expense %s for anomalies: %v", hexID(expense.ID), err)
+		}
+	})
+}
+
+// inBackground runs fn in its own goroutine under anomalyCheckTimeout.
+// HandleClose waits for it before closing the store.
+func (h *Handler) inBackground(fn func(ctx context.Context)) {
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), anomalyCheckTimeout)
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// AnomalyScan reports what ScanAnomalies looked at.
+type AnomalyScan struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Sales    int       `json:"sales"`
+	Expenses int       `json:"expenses"`
+	Days     int       `json:"days"`
+	Flagged  int       `json:"flagged"`
+}
+
+// ScanAnomalies runs every check over [from, to]. It catches what the
+// write-time checks cannot, such as a day that ends with too few sales,
+// and re-checks records against norms that have moved since.
+func (h *Handler) ScanAnomalies(ctx context.Context, from, to time.Time) (AnomalyScan, error) {
+	scan := AnomalyScan{From: from, To: to}
+
+	sales, err := h.store.Sales().SalesBetween(ctx, from, to)
+	if err != nil {
+		return scan, fmt.Errorf("error reading sales: %w", err)
+	}
+	for _, sale := range sales {
+		a, flagged := saleTotalAnomaly(sale)
+		if err := h.saveAnomaly(ctx, saleTotalKey(hexID(sale.ID)), a, flagged); err != nil {
+			return scan, err
+		}
+		scan.Sales++
+		if flagged {
+			scan.Flagged++
+		}
+	}
+
+	expenses, err := h.store.Expenses().ExpensesBetween(ctx, from.AddDate(0, 0, -expenseNormDays), to)
+	if err != nil {
+		return scan, fmt.Errorf("error reading expenses: %w", err)
+	}
+	for i, expense := range expenses {
+		if expense.TimeAdded.Before(from) {
+			continue
+		}
+		// expenses is oldest first, so the norm comes from just before i.
+		normFrom := expense.TimeAdded.AddDate(0, 0, -expenseNormDays)
+		first := sort.Search(i, func(j int) bool { return !expenses[j].TimeAdded.Before(normFrom) })
+		a, flagged := highExpenseAnomaly(expense, expenses[first:i])
+		if err := h.saveAnomaly(ctx, highExpenseKey(hexID(expense.ID)), a, flagged); err != nil {
+			return scan, err
+		}
+		scan.Expenses++
+		if flagged {
+			scan.Flagged++
+		}
+	}
+
+	days, err := h.dailyHistory(ctx, from.AddDate(0, 0, -7*baselineWeeks), to)
+	if err != nil {
+		return scan, err
+	}
+	for day := h.dayOf(from); !day.After(to); day = h.nextDay(day) {
+		if _, end := h.calculateDateRange(day, "daily"); end.After(time.Now()) {
+			break
+		}
+		a, flagged := h.lowSalesAnomaly(day, days)
+		if err := h.saveAnomaly(ctx, lowSalesKey(day), a, flagged); err != nil {
+			return scan, err
+		}
+		scan.Days++
+		if flagged {
+			scan.Flagged++
+		}
+	}
+	return scan, nil
+}
+
+// anomalyScanRange is the last anomalyScanDays days and today.
+func (h *Handler) anomalyScanRange() (time.Time, time.Time) {
+	today, end := h.calculateDateRange(time.Now(), "daily")
+	return today.AddDate(0, 0, -anomalyScanDays), end
+}
+
+// RunAnomalySchedule scans the last anomalyScanDays days now and then every
+// interval until ctx is done.
+func (h *Handler) RunAnomalySchedule(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		scanCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		from, to := h.anomalyScanRange()
+		scan, err := h.ScanAnomalies(scanCtx, from, to)
+		cancel()
+		if err != nil {
+			log.Printf("Error scanning for anomalies: %v", err)
+		} else {
+			log.Printf("Anomaly scan: %d sales, %d expenses, %d days checked, %d flagged", scan.Sales, scan.Expenses, scan.Days, scan.Flagged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
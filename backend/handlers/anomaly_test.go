@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"tacohut/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMedianCents(t *testing.T) {
+	tests := []struct {
+		values []int64
+		want   int64
+	}{
+		{[]int64{5}, 5},
+		{[]int64{3, 1, 2}, 2},
+		{[]int64{4, 1, 3, 2}, 2},
+		{[]int64{100, 300}, 200},
+		{[]int64{-10, 10, 0}, 0},
+	}
+
+	for _, tt := range tests {
+		values := append([]int64(nil), tt.values...)
+		if got := medianCents(values); got != tt.want {
+			t.Errorf("medianCents(%v) = %d, want %d", tt.values, got, tt.want)
+		}
+		for i := range values {
+			if values[i] != tt.values[i] {
+				t.Errorf("medianCents(%v) reordered its argument", tt.values)
+				break
+			}
+		}
+	}
+}
+
+func TestSaleTotalAnomaly(t *testing.T) {
+	sale := func(total int64, prices ...int64) models.SalesData {
+		s := models.SalesData{ID: primitive.NewObjectID(), Total: models.NewMoney(total)}
+		for _, price := range prices {
+			s.Items = append(s.Items, models.MenuItem{Name: "Taco", Quantity: 2, Price: models.NewMoney(price)})
+		}
+		return s
+	}
+
+	tests := []struct {
+		name     string
+		sale     models.SalesData
+		flagged  bool
+		severity string
+	}{
+		{"matches", sale(1000, 500), false, ""},
+		{"within tolerance", sale(1100, 500), false, ""},
+		{"short within tolerance", sale(900, 500), false, ""},
+		{"over", sale(1200, 500), true, models.SeverityWarning},
+		{"short", sale(700, 500), true, models.SeverityCritical},
+		{"far over", sale(2000, 250, 250), true, models.SeverityCritical},
+		{"no items", sale(500), true, models.SeverityCritical},
+	}
+
+	for _, tt := range tests {
+		a, flagged := saleTotalAnomaly(tt.sale)
+		if flagged != tt.flagged || a.Severity != tt.severity {
+			t.Errorf("%s: flagged %v (%s), want %v (%s)", tt.name, flagged, a.Severity, tt.flagged, tt.severity)
+		}
+		if flagged && (a.Kind != models.AnomalySaleTotal || a.Subject != hexID(tt.sale.ID)) {
+			t.Errorf("%s: anomaly %+v", tt.name, a)
+		}
+	}
+}
+
+func TestHighExpenseAnomaly(t *testing.T) {
+	at := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	expense := func(category string, cents int64, daysAgo int) models.ExpensesFetched {
+		return models.ExpensesFetched{
+			ID:        primitive.NewObjectID(),
+			Amount:    models.NewMoney(cents),
+			Category:  category,
+			TimeAdded: at.AddDate(0, 0, -daysAgo),
+		}
+	}
+	norm := func(n int) []models.ExpensesFetched {
+		var history []models.ExpensesFetched
+		for i := 1; i <= n; i++ {
+			history = append(history, expense("supplies", 1000, i))
+		}
+		return history
+	}
+
+	tests := []struct {
+		name     string
+		expense  models.ExpensesFetched
+		history  []models.ExpensesFetched
+		flagged  bool
+		severity string
+	}{
+		{"usual", expense("supplies", 1500, 0), norm(5), false, ""},
+		{"just under warning", expense("supplies", 2999, 0), norm(5), false, ""},
+		{"warning", expense("supplies", 3000, 0), norm(5), true, models.SeverityWarning},
+		{"critical", expense("supplies", 6000, 0), norm(5), true, models.SeverityCritical},
+		{"too little history", expense("supplies", 9000, 0), norm(4), false, ""},
+		{"other category", expense("rent", 9000, 0), norm(5), false, ""},
+		{"later expenses ignored", expense("supplies", 9000, 3), norm(5), false, ""},
+	}
+
+	for _, tt := range tests {
+		a, flagged := highExpenseAnomaly(tt.expense, tt.history)
+		if flagged != tt.flagged || a.Severity != tt.severity {
+			t.Errorf("%s: flagged %v (%s), want %v (%s)", tt.name, flagged, a.Severity, tt.flagged, tt.severity)
+		}
+		if flagged && a.Kind != models.AnomalyHighExpense {
+			t.Errorf("%s: kind %s", tt.name, a.Kind)
+		}
+	}
+}
+
+func TestLowSalesAnomaly(t *testing.T) {
+	h := New(nil, DefaultCalendar())
+	day := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	history := func(weeks int, cents int64) map[time.Time]models.AnalyticsSummary {
+		days := make(map[time.Time]models.AnalyticsSummary)
+		for week := 1; week <= weeks; week++ {
+			earlier := day.AddDate(0, 0, -7*week)
+			days[earlier] = models.AnalyticsSummary{TotalSales: models.NewMoney(cents)}
+			// Other weekdays must not count towards the baseline.
+			days[earlier.AddDate(0, 0, 1)] = models.AnalyticsSummary{TotalSales: models.NewMoney(100 * cents)}
+		}
+		return days
+	}
+	with := func(days map[time.Time]models.AnalyticsSummary, cents int64) map[time.Time]models.AnalyticsSummary {
+		days[day] = models.AnalyticsSummary{TotalSales: models.NewMoney(cents)}
+		return days
+	}
+
+	tests := []struct {
+		name     string
+		days     map[time.Time]models.AnalyticsSummary
+		flagged  bool
+		severity string
+	}{
+		{"usual", with(history(8, 10000), 9000), false, ""},
+		{"half", with(history(8, 10000), 5000), false, ""},
+		{"warning", with(history(8, 10000), 4000), true, models.SeverityWarning},
+		{"critical", with(history(8, 10000), 2000), true, models.SeverityCritical},
+		{"no sales at all", history(8, 10000), true, models.SeverityCritical},
+		{"too little history", with(history(2, 10000), 0), false, ""},
+		{"always closed", with(history(8, 0), 0), false, ""},
+	}
+
+	for _, tt := range tests {
+		a, flagged := h.lowSalesAnomaly(day, tt.days)
+		if flagged != tt.flagged || a.Severity != tt.severity {
+			t.Errorf("%s: flagged %v (%s), want %v (%s)", tt.name, flagged, a.Severity, tt.flagged, tt.severity)
+		}
+		if flagged && (a.Kind != models.AnomalyLowSales || a.Subject != "2024-03-05") {
+			t.Errorf("%s: anomaly %+v", tt.name, a)
+		}
+	}
+}
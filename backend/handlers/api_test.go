@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tacohut/models"
+	"tacohut/store"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *Handler) {
+	t.Helper()
+	return newTestServerWith(t, store.NewMemoryStore(), DefaultCalendar())
+}
+
+func newTestServerWith(t *testing.T, s store.Store, calendar Calendar) (*httptest.Server, *Handler) {
+	t.Helper()
+	h := New(s, calendar)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/saledata", h.Saledata)
+	mux.HandleFunc("/api/fetchSaleData", h.FetchSaleData)
+	mux.HandleFunc("/api/analytics", h.GetAnalytics)
+	mux.HandleFunc("/api/anomalies", h.FetchAnomalies)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, h
+}
+
+func postSale(t *testing.T, server *httptest.Server, sale string) {
+	t.Helper()
+	resp, err := http.Post(server.URL+"/api/saledata", "application/json", strings.NewReader(sale))
+	if err != nil {
+		t.Fatalf("POST /api/saledata: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /api/saledata: status %d", resp.StatusCode)
+	}
+}
+
+// getJSON fetches url and decodes the "data" of the response into data.
+func getJSON(t *testing.T, url string, data interface{}) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", url, resp.StatusCode)
+	}
+	body := struct {
+		Data interface{} `json:"data"`
+	}{Data: data}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+}
+
+func TestPostSaleThenReadAnalytics(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	postSale(t, server, `{
+		"items": [
+			{"menuItemId": "al-pastor", "name": "Al Pastor", "quantity": 2, "price": 4.5, "cost": 1.25},
+			{"menuItemId": "horchata", "name": "Horchata", "quantity": 1, "price": 3, "cost": 0.5}
+		],
+		"paymentMethod": "card",
+		"total": 12,
+		"recordedAt": "2024-03-05T13:30:00Z"
+	}`)
+
+	var sales []models.SalesData
+	getJSON(t, server.URL+"/api/fetchSaleData", &sales)
+	if len(sales) != 1 || sales[0].Total.Cents != 1200 {
+		t.Fatalf("fetchSaleData = %+v, want the posted sale", sales)
+	}
+
+	for _, period := range []string{"daily", "weekly", "monthly", "yearly"} {
+		var summary models.AnalyticsSummary
+		getJSON(t, server.URL+"/api/analytics?period="+period+"&date=2024-03-05", &summary)
+
+		if summary.TotalSales.Cents != 1200 || summary.TransactionCount != 1 {
+			t.Errorf("%s: sales %d over %d transactions, want 1200 over 1", period, summary.TotalSales.Cents, summary.TransactionCount)
+		}
+		if summary.CostOfGoods.Cents != 300 || summary.GrossProfit.Cents != 900 {
+			t.Errorf("%s: cost of goods %d, gross profit %d; want 300, 900", period, summary.CostOfGoods.Cents, summary.GrossProfit.Cents)
+		}
+		if summary.ItemsSold["Al Pastor"] != 2 || summary.PaymentMethods["card"].Cents != 1200 {
+			t.Errorf("%s: items %v, payment methods %v", period, summary.ItemsSold, summary.PaymentMethods)
+		}
+	}
+}
+
+func TestPostSaleFlagsMismatchedTotal(t *testing.T) {
+	server, h := newTestServer(t)
+
+	postSale(t, server, `{
+		"items": [{"menuItemId": "al-pastor", "name": "Al Pastor", "quantity": 2, "price": 4.5}],
+		"paymentMethod": "cash",
+		"total": 20,
+		"recordedAt": "2024-03-05T13:30:00Z"
+	}`)
+	h.background.Wait()
+
+	var anomalies []models.Anomaly
+	getJSON(t, server.URL+"/api/anomalies", &anomalies)
+	if len(anomalies) != 1 || anomalies[0].Kind != models.AnomalySaleTotal || anomalies[0].Severity != models.SeverityCritical {
+		t.Errorf("anomalies = %+v, want one critical sale total anomaly", anomalies)
+	}
+}
+
+func TestPostSaleRejectsUnsafePaymentMethod(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	for _, method := range []string{"m.pesa", "$cash"} {
+		resp, err := http.Post(server.URL+"/api/saledata", "application/json", strings.NewReader(`{
+			"items": [{"menuItemId": "al-pastor", "name": "Al Pastor", "quantity": 1, "price": 4.5}],
+			"paymentMethod": "`+method+`",
+			"total": 4.5
+		}`))
+		if err != nil {
+			t.Fatalf("POST /api/saledata: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("payment method %q: status %d, want %d", method, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+
+	var sales []models.SalesData
+	getJSON(t, server.URL+"/api/fetchSaleData", &sales)
+	if len(sales) != 0 {
+		t.Errorf("fetchSaleData = %+v, want nothing saved", sales)
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ItemPair is two menu items bought in the same sale. For the rule
+// "A, so also B":
+//
+//	support      share of all sales holding both
+//	confidenceAB share of sales holding A that also hold B
+//	lift         confidence over B's own support; above 1 means the pair
+//	             sells together more often than chance
+type ItemPair struct {
+	ItemA        string  `json:"itemA"`
+	NameA        string  `json:"nameA"`
+	ItemB        string  `json:"itemB"`
+	NameB        string  `json:"nameB"`
+	Count        int     `json:"count"`
+	Support      float64 `json:"support"`
+	ConfidenceAB float64 `json:"confidenceAB"`
+	ConfidenceBA float64 `json:"confidenceBA"`
+	Lift         float64 `json:"lift"`
+}
+
+type BasketReport struct {
+	From         time.Time  `json:"from"`
+	To           time.Time  `json:"to"`
+	Transactions int        `json:"transactions"`
+	MinSupport   float64    `json:"minSupport"`
+	MinCount     int        `json:"minCount"`
+	SortBy       string     `json:"sortBy"`
+	Pairs        []ItemPair `json:"pairs"`
+}
+
+// defaultMinCount drops pairs seen only once, which say nothing about
+// habits but dominate small samples.
+const defaultMinCount = 2
+
+// GetBasketAnalysis serves GET /api/analytics/basket?from=...&to=...
+// (default the last four weeks). Pairs below minSupport (0-1, default 0)
+// or minCount (default 2) are dropped, the rest are sorted by lift
+// (default), support or confidence and cut to limit.
+func (h *Handler) GetBasketAnalysis(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := h.parseRecentRange(r)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var minSupport float64
+	if value := r.URL.Query().Get("minSupport"); value != "" {
+		minSupport, err = strconv.ParseFloat(value, 64)
+		if err != nil || minSupport < 0 || minSupport > 1 {
+			http.Error(w, "Bad request: minSupport must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+	}
+
+	minCount := defaultMinCount
+	if value := r.URL.Query().Get("minCount"); value != "" {
+		minCount, err = strconv.Atoi(value)
+		if err != nil || minCount < 1 {
+			http.Error(w, "Bad request: minCount must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sortBy := r.URL.Query().Get("sort")
+	switch sortBy {
+	case "":
+		sortBy = "lift"
+	case "lift", "support", "confidence":
+	default:
+		http.Error(w, "Invalid sort. Use: lift, support, confidence", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	report, err := h.BasketAnalysis(ctx, from, to, minSupport, minCount, sortBy, limit)
+	if err != nil {
+		log.Printf("Error building basket analysis: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeAnalytics(w, report)
+}
+
+// BasketAnalysis counts co-purchases in the sales recorded in [from, to].
+// An item counts once per sale however many were ordered; items are keyed
+// as in the rollups, by menu item id.
+func (h *Handler) BasketAnalysis(ctx context.Context, from, to time.Time, minSupport float64, minCount int, sortBy string, limit int) (BasketReport, error) {
+	sales, err := h.store.Sales().SalesBetween(ctx, from, to)
+	if err != nil {
+		return BasketReport{}, err
+	}
+
+	report := BasketReport{
+		From:         from,
+		To:           to,
+		Transactions: len(sales),
+		MinSupport:   minSupport,
+		MinCount:     minCount,
+		SortBy:       sortBy,
+		Pairs:        []ItemPair{},
+	}
+
+	type pair struct{ a, b string }
+	names := make(map[string]string)
+	itemCounts := make(map[string]int)
+	pairCounts := make(map[pair]int)
+
+	for _, sale := range sales {
+		var keys []string
+		seen := make(map[string]bool)
+		for _, item := range sale.Items {
+			key := itemKey(item)
+			if item.Quantity <= 0 || seen[key] {
+				continue
+			}
+			seen[key] = true
+			names[key] = item.Name
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for i, a := range keys {
+			itemCounts[a]++
+			for _, b := range keys[i+1:] {
+				pairCounts[pair{a, b}]++
+			}
+		}
+	}
+
+	if len(sales) == 0 {
+		return report, nil
+	}
+	n := float64(len(sales))
+	for p, count := range pairCounts {
+		support := float64(count) / n
+		if count < minCount || support < minSupport {
+			continue
+		}
+		report.Pairs = append(report.Pairs, ItemPair{
+			ItemA:        p.a,
+			NameA:        names[p.a],
+			ItemB:        p.b,
+			NameB:        names[p.b],
+			Count:        count,
+			Support:      roundRatio(support),
+			ConfidenceAB: roundRatio(float64(count) / float64(itemCounts[p.a])),
+			ConfidenceBA: roundRatio(float64(count) / float64(itemCounts[p.b])),
+			Lift:         roundRatio(float64(count) * n / float64(itemCounts[p.a]*itemCounts[p.b])),
+		})
+	}
+
+	key := func(p ItemPair) float64 {
+		switch sortBy {
+		case "support":
+			return p.Support
+		case "confidence":
+			return math.Max(p.ConfidenceAB, p.ConfidenceBA)
+		}
+		return p.Lift
+	}
+	sort.Slice(report.Pairs, func(i, j int) bool {
+		a, b := report.Pairs[i], report.Pairs[j]
+		if key(a) != key(b) {
+			return key(a) > key(b)
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.ItemA+"|"+a.ItemB < b.ItemA+"|"+b.ItemB
+	})
+	if len(report.Pairs) > limit {
+		report.Pairs = report.Pairs[:limit]
+	}
+	return report, nil
+}
+
+// roundRatio rounds a ratio to four decimals.
+func roundRatio(x float64) float64 {
+	return math.Round(x*10000) / 10000
+}
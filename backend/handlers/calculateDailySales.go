@@ -2,245 +2,77 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"net/http"
+	"strings"
 	"time"
-	"strconv"
 
-	"tacohut/middlewares"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"tacohut/models"
 )
 
-type DailyData struct { // can also be the struct for weekly, monthly and yearly
-	ID             interface{}        `bson:"_id,omitempty"`
-	Date           time.Time          `bson:"date"`
-	ItemsSold      map[string]int     `bson:"itemsSold"`
-	PaymentSummary map[string]int     `bson:"paymentSummary"`
-	TotalSales     int                `bson:"totalSales"`
-	TotalExpenses  int                `bson:"totalExpenses"`
-	NetProfit      int                `bson:"netProfit"`
-	ExpenseCategory map[string]int    `bson:"expenseCategory"`
-	LastUpdated    time.Time          `bson:"lastUpdated"`
-}
-
-func (randomSales SalesData) CalculateDailySales(w http.ResponseWriter, r *http.Request) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	currentDate := time.Now().Truncate(24 * time.Hour)
-
-	if middlewares.DailyAnalytics == nil {
-		return respondWithError(w, http.StatusInternalServerError, "database connection error")
-	}
-
-	collection := middlewares.DailyAnalytics.Collection("dailyAnalysis")
-	filter := bson.M{"date": currentDate}
-
-	// Build update operation
-	update := bson.M{
-		"$inc": bson.M{
-			"totalSales": randomSales.Total,
-		},
-		"$set": bson.M{
-			"lastUpdated": time.Now(),
-		},
-		"$setOnInsert": bson.M{
-			"date":            currentDate,
-			"itemsSold":       make(map[string]int),
-			"paymentSummary":  make(map[string]int),
-			"totalExpenses":   0,
-			"netProfit":       0,
-			"expenseCategory": make(map[string]int),
-		},
-	}
-
-	itemsUpdate := bson.M{}
-	for _, item := range randomSales.Items {
-		itemsUpdate["itemsSold."+item.Name] = item.Quantity
-	}
-	update["$inc"].(bson.M)["itemsSold"] = itemsUpdate
-
-	update["$inc"].(bson.M)["paymentSummary."+randomSales.PaymentMethod] = 1
-
-	if _, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
-		return respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error updating daily sales: %v", err))
-	}
-
-	if err := recalculateDailyProfit(middlewares.DailyAnalytics, currentDate); err != nil {
-		return respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error recalculating profit: %v", err))
-	}
-
-	return respondWithSuccess(w, "daily sales updated successfully")
+// dayOf returns the dailyAnalysis key for a timestamp: the start of its
+// business day.
+func (h *Handler) dayOf(t time.Time) time.Time {
+	return h.calendar.DayStart(t)
 }
 
-func (randomExpenses Expenses) CalculateDailyExpenses(w http.ResponseWriter, r *http.Request) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	currentDate := time.Now().Truncate(24 * time.Hour)
-
-	if middlewares.DailyAnalytics == nil {
-		return respondWithError(w, http.StatusInternalServerError, "database connection error")
+// moveDay is movePeriods for dailyAnalysis.
+func (h *Handler) moveDay(ctx context.Context, oldAt time.Time, removed models.AnalyticsDelta, newAt time.Time, added models.AnalyticsDelta) error {
+	if h.dayOf(oldAt).Equal(h.dayOf(newAt)) {
+		delta := models.AnalyticsDelta{}
+		addDelta(&delta, removed)
+		addDelta(&delta, added)
+		return h.store.Daily().IncrementDay(ctx, h.dayOf(newAt), delta)
 	}
-
-	collection := middlewares.DailyAnalytics.Collection("dailyAnalysis")
-	filter := bson.M{"date": currentDate}
-
-	update := bson.M{
-		"$inc": bson.M{
-			"totalExpenses":              randomExpenses.Amount,
-			"expenseCategory." + randomExpenses.Category: randomExpenses.Amount,
-		},
-		"$set": bson.M{
-			"lastUpdated": time.Now(),
-		},
-		"$setOnInsert": bson.M{
-			"date":           currentDate,
-			"itemsSold":      make(map[string]int),
-			"paymentSummary": make(map[string]int),
-			"totalSales":     0,
-			"netProfit":      0,
-		},
+	if err := h.store.Daily().IncrementDay(ctx, h.dayOf(oldAt), removed); err != nil {
+		return err
 	}
-
-	if _, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
-		return respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error updating daily expenses: %v", err))
-	}
-
-	if err := recalculateDailyProfit(middlewares.DailyAnalytics, currentDate); err != nil {
-		return respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error recalculating profit: %v", err))
-	}
-
-	return respondWithSuccess(w, "daily expenses updated successfully")
+	return h.store.Daily().IncrementDay(ctx, h.dayOf(newAt), added)
 }
 
-func (randomSales SalesData) CalculateDailySalesDeleted(w http.ResponseWriter, r *http.Request) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	saleDate := randomSales.RecordedAt.Truncate(24 * time.Hour)
-
-	if middlewares.DailyAnalytics == nil {
-		return respondWithError(w, http.StatusInternalServerError, "database connection error")
+// saleDailyDelta is the change a sale makes to its dailyAnalysis document.
+// Unlike period rollups, the daily payment summary counts transactions.
+func saleDailyDelta(randomSales models.SalesData, sign int) models.AnalyticsDelta {
+	delta := models.AnalyticsDelta{
+		ItemsSold:      make(map[string]int),
+		PaymentMethods: map[string]int64{randomSales.PaymentMethod: int64(sign)},
+		TotalSales:     randomSales.Total.Mul(sign).Cents,
 	}
 
-	collection := middlewares.DailyAnalytics.Collection("dailyAnalysis")
-	filter := bson.M{"date": saleDate}
-
-	update := bson.M{
-		"$inc": bson.M{
-			"totalSales": -randomSales.Total,
-		},
-		"$set": bson.M{
-			"lastUpdated": time.Now(),
-		},
-	}
-
-	itemsUpdate := bson.M{}
 	for _, item := range randomSales.Items {
-		itemsUpdate["itemsSold."+item.Name] = -item.Quantity
-	}
-	update["$inc"].(bson.M)["itemsSold"] = itemsUpdate
-
-	update["$inc"].(bson.M)["paymentSummary."+randomSales.PaymentMethod] = -1
-
-	if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
-		return respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error updating deleted sales: %v", err))
-	}
-
-	if err := recalculateDailyProfit(middlewares.DailyAnalytics, saleDate); err != nil {
-		return respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error recalculating profit: %v", err))
+		delta.ItemsSold[item.Name] += sign * item.Quantity
 	}
 
-	return respondWithSuccess(w, "deleted sales updated successfully")
+	return delta
 }
 
-func (randomExpenses Expenses) CalculateDailyExpensesDeleted(w http.ResponseWriter, r *http.Request) error {
-    ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-    defer cancel()
-
-    expenseDate := randomExpenses.TimeAdded.Truncate(24 * time.Hour)
-
-    if middlewares.DailyAnalytics == nil {
-        return respondWithError(w, http.StatusInternalServerError, "database connection error")
-    }
-
-    // Convert string amount to integer
-    amount, err := strconv.Atoi(randomExpenses.Amount)
-    if err != nil {
-        return respondWithError(w, http.StatusBadRequest, "invalid expense amount format")
-    }
-
-    collection := middlewares.DailyAnalytics.Collection("dailyAnalysis")
-    filter := bson.M{"date": expenseDate}
-
-    update := bson.M{
-        "$inc": bson.M{
-            "totalExpenses": -amount, // Now using the converted integer value
-        },
-        "$set": bson.M{
-            "lastUpdated": time.Now(),
-        },
-    }
-
-    if randomExpenses.Category != "" {
-        update["$inc"].(bson.M)["expenseCategory."+randomExpenses.Category] = -amount
-    }
-
-    if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
-        return respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error updating deleted expenses: %v", err))
-    }
-
-    if err := recalculateDailyProfit(middlewares.DailyAnalytics, expenseDate); err != nil {
-        return respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error recalculating profit: %v", err))
-    }
-
-    return respondWithSuccess(w, "deleted expenses updated successfully")
-}
-
-func recalculateDailyProfit(db *mongo.Database, date time.Time) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	collection := db.Collection("dailyAnalysis")
-	filter := bson.M{"date": date}
-
-	var dailyData DailyData
-	if err := collection.FindOne(ctx, filter).Decode(&dailyData); err != nil {
-		return fmt.Errorf("error finding daily data: %v", err)
-	}
-
-	netProfit := dailyData.TotalSales - dailyData.TotalExpenses
-
-	update := bson.M{
-		"$set": bson.M{
-			"netProfit":    netProfit,
-			"lastUpdated": time.Now(),
-		},
+// expenseDelta is the change an expense makes to its dailyAnalysis
+// document and to each period rollup, where it counts as an operating
+// expense.
+func expenseDelta(randomExpenses models.Expenses, sign int) models.AnalyticsDelta {
+	amount := randomExpenses.Amount.Mul(sign).Cents
+	return models.AnalyticsDelta{
+		ExpenseCategories: map[string]int64{randomExpenses.Category: amount},
+		TotalExpenses:     amount,
 	}
+}
 
-	if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
-		return fmt.Errorf("error updating profit: %v", err)
+// checkCurrency rejects amounts in a currency other than the shop's, since
+// rollups only ever hold one currency.
+func checkCurrency(amounts ...models.Money) error {
+	for _, amount := range amounts {
+		if amount.CurrencyCode() != models.Currency {
+			return fmt.Errorf("amount %s is not in %s", amount, models.Currency)
+		}
 	}
-
 	return nil
 }
 
-func respondWithError(w http.ResponseWriter, code int, message string) error {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
-	return errors.New(message)
-}
-
-func respondWithSuccess(w http.ResponseWriter, message string) error {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": message})
+// checkRollupKey rejects an expense category or payment method that
+// cannot name a rollup field: Mongo reads "." in a field path as nesting
+// and a leading "$" as an operator.
+func checkRollupKey(kind, key string) error {
+	if strings.Contains(key, ".") || strings.HasPrefix(key, "$") {
+		return fmt.Errorf(`%s %q cannot contain "." or start with "$"`, kind, key)
+	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calendar decides which business day, week, month and year an instant
+// belongs to. Every rollup, date filter and report goes through it, so a
+// sale at 22:00 in Nairobi is counted on the same day everywhere.
+//
+// A business day starts at DayStartHour local time, so with 4 a sale at
+// 02:30 still counts towards the previous day. Weeks start on WeekStart
+// and "yearly" rollups cover the fiscal year starting on the first of
+// FiscalYearStart. Periods of several days or weeks, such as payroll
+// fortnights, are counted from Anchor.
+//
+// Periods lists the rollups kept for every sale, in the order they are
+// written.
+type Calendar struct {
+	Location        *time.Location
+	DayStartHour    int
+	WeekStart       time.Weekday
+	FiscalYearStart time.Month
+	Anchor          time.Time
+	Periods         []Period
+}
+
+// PeriodUnit is the calendar unit a Period is counted in.
+type PeriodUnit string
+
+const (
+	UnitHour  PeriodUnit = "h"
+	UnitDay   PeriodUnit = "d"
+	UnitWeek  PeriodUnit = "w"
+	UnitMonth PeriodUnit = "m"
+	UnitYear  PeriodUnit = "y"
+)
+
+// Period is a rollup length: Length units of Unit, e.g. quarterly is three
+// months. Name is what rollups are stored and queried under.
+type Period struct {
+	Name   string
+	Unit   PeriodUnit
+	Length int
+}
+
+// builtinPeriods can be enabled by name alone.
+var builtinPeriods = []Period{
+	{"hourly", UnitHour, 1},
+	{"daily", UnitDay, 1},
+	{"weekly", UnitWeek, 1},
+	{"fortnightly", UnitWeek, 2},
+	{"monthly", UnitMonth, 1},
+	{"quarterly", UnitMonth, 3},
+	{"yearly", UnitYear, 1},
+}
+
+const defaultPeriods = "daily,weekly,monthly,yearly"
+
+// DefaultCalendar is UTC calendar days, Monday weeks and January years,
+// with daily, weekly, monthly and yearly rollups.
+func DefaultCalendar() Calendar {
+	periods, _ := parsePeriods(defaultPeriods)
+	return Calendar{
+		Location:        time.UTC,
+		DayStartHour:    0,
+		WeekStart:       time.Monday,
+		FiscalYearStart: time.January,
+		Anchor:          time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Periods:         periods,
+	}
+}
+
+// LoadCalendar reads the calendar from the environment, falling back to
+// DefaultCalendar for anything unset:
+//
+//	BUSINESS_TIMEZONE        IANA name, e.g. Africa/Nairobi
+//	BUSINESS_DAY_START_HOUR  0-23
+//	BUSINESS_WEEK_START      weekday name, e.g. monday
+//	FISCAL_YEAR_START_MONTH  1-12
+//	BUSINESS_PERIOD_ANCHOR   YYYY-MM-DD, e.g. the first payroll day
+//	ANALYTICS_PERIODS        comma separated, e.g. daily,weekly,quarterly,payroll=2w
+//
+// ANALYTICS_PERIODS takes builtin names (hourly, daily, weekly,
+// fortnightly, monthly, quarterly, yearly) or name=<n><unit> with unit
+// h, d, w, m or y.
+//
+// Changing any of these moves rollup boundaries; SyncCalendar rebuilds
+// analytics on the next start.
+func LoadCalendar() (Calendar, error) {
+	c := DefaultCalendar()
+
+	if name := os.Getenv("BUSINESS_TIMEZONE"); name != "" {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return c, fmt.Errorf("invalid BUSINESS_TIMEZONE: %w", err)
+		}
+		c.Location = loc
+	}
+
+	if value := os.Getenv("BUSINESS_DAY_START_HOUR"); value != "" {
+		hour, err := strconv.Atoi(value)
+		if err != nil || hour < 0 || hour > 23 {
+			return c, fmt.Errorf("invalid BUSINESS_DAY_START_HOUR %q, use 0-23", value)
+		}
+		c.DayStartHour = hour
+	}
+
+	if value := os.Getenv("BUSINESS_WEEK_START"); value != "" {
+		found := false
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			if strings.EqualFold(day.String(), value) {
+				c.WeekStart, found = day, true
+			}
+		}
+		if !found {
+			return c, fmt.Errorf("invalid BUSINESS_WEEK_START %q, use a weekday name", value)
+		}
+	}
+
+	if value := os.Getenv("FISCAL_YEAR_START_MONTH"); value != "" {
+		month, err := strconv.Atoi(value)
+		if err != nil || month < 1 || month > 12 {
+			return c, fmt.Errorf("invalid FISCAL_YEAR_START_MONTH %q, use 1-12", value)
+		}
+		c.FiscalYearStart = time.Month(month)
+	}
+
+	if value := os.Getenv("BUSINESS_PERIOD_ANCHOR"); value != "" {
+		anchor, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return c, fmt.Errorf("invalid BUSINESS_PERIOD_ANCHOR %q, use YYYY-MM-DD", value)
+		}
+		c.Anchor = anchor
+	}
+
+	if value := os.Getenv("ANALYTICS_PERIODS"); value != "" {
+		periods, err := parsePeriods(value)
+		if err != nil {
+			return c, fmt.Errorf("invalid ANALYTICS_PERIODS: %w", err)
+		}
+		c.Periods = periods
+	}
+
+	return c, nil
+}
+
+// parsePeriods reads a comma separated ANALYTICS_PERIODS list.
+func parsePeriods(value string) ([]Period, error) {
+	var periods []Period
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, spec, custom := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validPeriodName(name) {
+			return nil, fmt.Errorf("period name %q must be lowercase letters and digits", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("period %s listed twice", name)
+		}
+		seen[name] = true
+
+		if !custom {
+			p, ok := builtinPeriod(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown period %s, use name=<n><unit> for custom lengths", name)
+			}
+			periods = append(periods, p)
+			continue
+		}
+
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			return nil, fmt.Errorf("period %s has no length", name)
+		}
+		unit := PeriodUnit(spec[len(spec)-1:])
+		length, err := strconv.Atoi(spec[:len(spec)-1])
+		if err != nil || length < 1 {
+			return nil, fmt.Errorf("period %s: invalid length %q", name, spec)
+		}
+		switch unit {
+		case UnitHour, UnitDay, UnitWeek, UnitMonth, UnitYear:
+		default:
+			return nil, fmt.Errorf("period %s: unit must be h, d, w, m or y", name)
+		}
+		periods = append(periods, Period{Name: name, Unit: unit, Length: length})
+	}
+
+	if len(periods) == 0 {
+		return nil, fmt.Errorf("no periods listed")
+	}
+	return periods, nil
+}
+
+func validPeriodName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func builtinPeriod(name string) (Period, bool) {
+	for _, p := range builtinPeriods {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Period{}, false
+}
+
+// Period looks up a configured rollup period, or a builtin one so that
+// reports can still bucket by, say, days when daily rollups are off.
+func (c Calendar) Period(name string) (Period, bool) {
+	for _, p := range c.Periods {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return builtinPeriod(name)
+}
+
+// withinWeek reports whether the period fits a week evenly, so that a week
+// earlier is the same period of the previous week.
+func (p Period) withinWeek() bool {
+	switch p.Unit {
+	case UnitHour:
+		return true
+	case UnitDay:
+		return 7%p.Length == 0
+	case UnitWeek:
+		return p.Length == 1
+	}
+	return false
+}
+
+// Rollup reports whether rollups of the named period are kept.
+func (c Calendar) Rollup(name string) bool {
+	for _, p := range c.Periods {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PeriodNames lists the configured rollups, e.g. for error messages.
+func (c Calendar) PeriodNames() []string {
+	names := make([]string, len(c.Periods))
+	for i, p := range c.Periods {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// date returns the business date t falls on.
+func (c Calendar) date(t time.Time) (int, time.Month, int) {
+	return t.In(c.Location).Add(-time.Duration(c.DayStartHour) * time.Hour).Date()
+}
+
+// at returns the start of the business day with the given date.
+func (c Calendar) at(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, c.DayStartHour, 0, 0, 0, c.Location)
+}
+
+// DayStart returns the start of the business day containing t.
+func (c Calendar) DayStart(t time.Time) time.Time {
+	return c.at(c.date(t))
+}
+
+// ParseDay reads a YYYY-MM-DD business date and returns when it starts.
+func (c Calendar) ParseDay(value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return c.at(t.Date()), nil
+}
+
+// Range returns the first and last instant of the named period containing
+// t. Unknown names return t, t.
+func (c Calendar) Range(t time.Time, period string) (time.Time, time.Time) {
+	p, ok := c.Period(period)
+	if !ok {
+		return t, t
+	}
+
+	year, month, day := c.date(t)
+	n := p.Length
+
+	var start, next time.Time
+	switch p.Unit {
+	case UnitHour:
+		// Hour buckets restart at every business day start and the last
+		// one is cut short if n does not divide the day.
+		dayStart := c.at(year, month, day)
+		hours := int(t.Sub(dayStart) / time.Hour)
+		start = dayStart.Add(time.Duration(hours/n*n) * time.Hour)
+		next = start.Add(time.Duration(n) * time.Hour)
+		if dayEnd := c.at(year, month, day+1); next.After(dayEnd) {
+			next = dayEnd
+		}
+
+	case UnitDay:
+		offset := floorMod(daysBetween(c.Anchor, year, month, day), n)
+		start = c.at(year, month, day-offset)
+		next = c.at(year, month, day-offset+n)
+
+	case UnitWeek:
+		// Multi-week periods count whole weeks from the week holding the
+		// anchor, so payroll fortnights line up with a known pay day.
+		offset := (int(c.at(year, month, day).Weekday()) - int(c.WeekStart) + 7) % 7
+		ay, am, ad := c.Anchor.Date()
+		anchorOffset := (int(c.at(ay, am, ad).Weekday()) - int(c.WeekStart) + 7) % 7
+		weeks := daysBetween(c.Anchor.AddDate(0, 0, -anchorOffset), year, month, day-offset) / 7
+		offset += floorMod(weeks, n) * 7
+		start = c.at(year, month, day-offset)
+		next = c.at(year, month, day-offset+7*n)
+
+	case UnitMonth:
+		// Months are counted from the fiscal year start, so quarterly
+		// rollups are fiscal quarters.
+		months := year*12 + int(month-c.FiscalYearStart)
+		first := months - floorMod(months, n)
+		start = c.at(0, c.FiscalYearStart+time.Month(first), 1)
+		next = c.at(0, c.FiscalYearStart+time.Month(first+n), 1)
+
+	case UnitYear:
+		if month < c.FiscalYearStart {
+			year--
+		}
+		year -= floorMod(year, n)
+		start = c.at(year, c.FiscalYearStart, 1)
+		next = c.at(year+n, c.FiscalYearStart, 1)
+
+	default:
+		return t, t
+	}
+	return start, next.Add(-time.Nanosecond)
+}
+
+// daysBetween counts calendar days from the date of anchor to the given
+// date.
+func daysBetween(anchor time.Time, year int, month time.Month, day int) int {
+	ay, am, ad := anchor.Date()
+	from := time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)
+	to := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+func floorMod(a, n int) int {
+	return ((a % n) + n) % n
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"tacohut/store"
+)
+
+// calendarSetting is the store setting holding the calendarSettings the
+// rollups were built with.
+const calendarSetting = "calendar"
+
+// calendarSettings is every part of a Calendar that moves rollup
+// boundaries, in a form that can be stored and compared.
+type calendarSettings struct {
+	Timezone        string   `json:"timezone"`
+	DayStartHour    int      `json:"dayStartHour"`
+	WeekStart       string   `json:"weekStart"`
+	FiscalYearStart int      `json:"fiscalYearStart"`
+	Anchor          string   `json:"anchor"`
+	Periods         []string `json:"periods"` // name=<n><unit>
+}
+
+func (c Calendar) settings() calendarSettings {
+	s := calendarSettings{
+		Timezone:        c.Location.String(),
+		DayStartHour:    c.DayStartHour,
+		WeekStart:       c.WeekStart.String(),
+		FiscalYearStart: int(c.FiscalYearStart),
+		Anchor:          c.Anchor.Format("2006-01-02"),
+	}
+	for _, p := range c.Periods {
+		s.Periods = append(s.Periods, fmt.Sprintf("%s=%d%s", p.Name, p.Length, p.Unit))
+	}
+	return s
+}
+
+// periodNames returns the rollup names of s.
+func (s calendarSettings) periodNames() []string {
+	names := make([]string, len(s.Periods))
+	for i, p := range s.Periods {
+		names[i], _, _ = strings.Cut(p, "=")
+	}
+	return names
+}
+
+// SyncCalendar makes sure the rollups were built with the current
+// calendar. After a change every rollup is cleared and rebuilt from the raw
+// sales and expenses, and only then is the new calendar recorded, so a
+// start that fails part way rebuilds again next time. Rollups found with no
+// calendar recorded come from builds that cut days in UTC and are rebuilt
+// the same way. Stores that keep nothing between runs have nothing to
+// check.
+func (h *Handler) SyncCalendar(ctx context.Context) error {
+	settings, ok := h.store.(store.Settings)
+	if !ok {
+		return nil
+	}
+
+	current, err := json.Marshal(h.calendar.settings())
+	if err != nil {
+		return err
+	}
+
+	var previous []string
+	stored, err := settings.GetSetting(ctx, calendarSetting)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		previous = DefaultCalendar().PeriodNames()
+		built, err := h.hasRollups(ctx, previous)
+		if err != nil {
+			return err
+		}
+		if !built {
+			log.Printf("Recording business calendar %s", current)
+			return settings.PutSetting(ctx, calendarSetting, string(current))
+		}
+		log.Printf("WARNING: analytics were built before the business calendar was recorded, rebuilding all analytics with %s", current)
+	case err != nil:
+		return fmt.Errorf("error reading the stored business calendar: %w", err)
+	case stored == string(current):
+		return nil
+	default:
+		log.Printf("WARNING: business calendar changed from %s to %s, rebuilding all analytics", stored, current)
+		var calendar calendarSettings
+		if err := json.Unmarshal([]byte(stored), &calendar); err != nil {
+			return fmt.Errorf("error reading the stored business calendar: %w", err)
+		}
+		previous = calendar.periodNames()
+	}
+
+	if err := h.clearRollups(ctx, previous); err != nil {
+		return err
+	}
+
+	from, to, found, err := h.recordedRange(ctx)
+	if err != nil {
+		return err
+	}
+	if found {
+		report, err := h.RebuildAnalytics(ctx, from, to, false)
+		if err != nil {
+			return fmt.Errorf("error rebuilding analytics: %w", err)
+		}
+		log.Printf("Rebuilt %d rollups from %s to %s", len(report.Drift), from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+
+	return settings.PutSetting(ctx, calendarSetting, string(current))
+}
+
+// hasRollups reports whether there is any dailyAnalysis document or rollup
+// of the current periods or of previous.
+func (h *Handler) hasRollups(ctx context.Context, previous []string) (bool, error) {
+	days, err := h.store.Daily().ListDays(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error reading daily analysis: %w", err)
+	}
+	if len(days) > 0 {
+		return true, nil
+	}
+
+	for _, period := range append(previous, h.calendar.PeriodNames()...) {
+		summaries, err := h.store.Periods().ListPeriods(ctx, period)
+		if err != nil {
+			return false, fmt.Errorf("error reading %s analytics: %w", period, err)
+		}
+		if len(summaries) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// clearRollups deletes every dailyAnalysis document and every period
+// rollup of the current periods and of previous, since rollups cut on the
+// old boundaries would otherwise sit next to the rebuilt ones.
+func (h *Handler) clearRollups(ctx context.Context, previous []string) error {
+	seen := make(map[string]bool)
+	for _, period := range append(previous, h.calendar.PeriodNames()...) {
+		if seen[period] {
+			continue
+		}
+		seen[period] = true
+
+		if err := h.store.Periods().ClearPeriods(ctx, period); err != nil {
+			return fmt.Errorf("error clearing %s analytics: %w", period, err)
+		}
+	}
+
+	days, err := h.store.Daily().ListDays(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading daily analysis: %w", err)
+	}
+	for _, day := range days {
+		if err := h.store.Daily().DeleteDayByDate(ctx, day.Date); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("error clearing daily analysis: %w", err)
+		}
+	}
+	return nil
+}
+
+// recordedRange returns the business days from the first to the last sale
+// or expense, or false when nothing has been recorded.
+func (h *Handler) recordedRange(ctx context.Context) (time.Time, time.Time, bool, error) {
+	var times []time.Time
+	for _, descending := range []bool{false, true} {
+		sales, err := h.store.Sales().ListSales(ctx, store.SalesQuery{SortBy: store.SortRecordedAt, Descending: descending, Limit: 1})
+		if err != nil {
+			return time.Time{}, time.Time{}, false, fmt.Errorf("error reading sales: %w", err)
+		}
+		for _, sale := range sales.Sales {
+			times = append(times, sale.RecordedAt)
+		}
+		expenses, err := h.store.Expenses().ListExpenses(ctx, store.ExpenseQuery{Descending: descending, Limit: 1})
+		if err != nil {
+			return time.Time{}, time.Time{}, false, fmt.Errorf("error reading expenses: %w", err)
+		}
+		for _, expense := range expenses.Expenses {
+			times = append(times, expense.TimeAdded)
+		}
+	}
+	if len(times) == 0 {
+		return time.Time{}, time.Time{}, false, nil
+	}
+
+	first, last := times[0], times[0]
+	for _, t := range times {
+		if t.Before(first) {
+			first = t
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+	from, _ := h.calculateDateRange(first, "daily")
+	_, to := h.calculateDateRange(last, "daily")
+	return from, to, true, nil
+}
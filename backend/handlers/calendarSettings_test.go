@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tacohut/models"
+	"tacohut/store"
+)
+
+func TestSyncCalendarRebuildsAfterChange(t *testing.T) {
+	ctx := context.Background()
+	db, err := store.OpenBolt(filepath.Join(t.TempDir(), "tacohut.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	defer db.Close(ctx)
+
+	server, h := newTestServerWith(t, db, DefaultCalendar())
+	if err := h.SyncCalendar(ctx); err != nil {
+		t.Fatalf("SyncCalendar: %v", err)
+	}
+	// Sunday: the last day of a Monday week, the first of a Sunday week.
+	postSale(t, server, `{
+		"items": [{"menuItemId": "al-pastor", "name": "Al Pastor", "quantity": 2, "price": 4.5}],
+		"paymentMethod": "cash",
+		"total": 9,
+		"recordedAt": "2024-03-10T12:00:00Z"
+	}`)
+	h.background.Wait()
+
+	mondayStart, mondayEnd := h.calculateDateRange(time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC), "weekly")
+	if _, err := db.Periods().FindPeriod(ctx, "weekly", mondayStart, mondayEnd); err != nil {
+		t.Fatalf("FindPeriod before the change: %v", err)
+	}
+
+	calendar := DefaultCalendar()
+	calendar.WeekStart = time.Sunday
+	h = New(db, calendar)
+	if err := h.SyncCalendar(ctx); err != nil {
+		t.Fatalf("SyncCalendar after the change: %v", err)
+	}
+
+	if _, err := db.Periods().FindPeriod(ctx, "weekly", mondayStart, mondayEnd); err != store.ErrNotFound {
+		t.Errorf("Monday week after the change: err = %v, want ErrNotFound", err)
+	}
+	sundayStart, sundayEnd := h.calculateDateRange(time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC), "weekly")
+	week, err := db.Periods().FindPeriod(ctx, "weekly", sundayStart, sundayEnd)
+	if err != nil {
+		t.Fatalf("FindPeriod after the change: %v", err)
+	}
+	if week.TotalSales.Cents != 900 || week.Items["al-pastor"].Quantity != 2 {
+		t.Errorf("rebuilt week = sales %d, items %+v; want 900 and 2 al-pastor", week.TotalSales.Cents, week.Items)
+	}
+
+	report, err := h.RebuildAnalytics(ctx, sundayStart, sundayEnd, true)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(report.Drift) != 0 {
+		t.Errorf("verify after the change found drift: %+v", report.Drift)
+	}
+}
+
+func TestSyncCalendarRebuildsUnrecordedRollups(t *testing.T) {
+	ctx := context.Background()
+	db, err := store.OpenBolt(filepath.Join(t.TempDir(), "tacohut.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	defer db.Close(ctx)
+
+	// Rollups written by a build that recorded no calendar, one of them
+	// cut on the wrong boundaries.
+	server, h := newTestServerWith(t, db, DefaultCalendar())
+	postSale(t, server, `{
+		"items": [{"menuItemId": "al-pastor", "name": "Al Pastor", "quantity": 2, "price": 4.5}],
+		"paymentMethod": "cash",
+		"total": 9,
+		"recordedAt": "2024-03-05T12:00:00Z"
+	}`)
+	h.background.Wait()
+	stray := time.Date(2024, 3, 5, 3, 0, 0, 0, time.UTC)
+	if err := db.Periods().IncrementPeriod(ctx, "daily", stray, stray.Add(24*time.Hour-time.Nanosecond), models.AnalyticsDelta{TotalSales: 900}); err != nil {
+		t.Fatalf("IncrementPeriod: %v", err)
+	}
+
+	if err := h.SyncCalendar(ctx); err != nil {
+		t.Fatalf("SyncCalendar: %v", err)
+	}
+
+	days, err := db.Periods().ListPeriods(ctx, "daily")
+	if err != nil {
+		t.Fatalf("ListPeriods: %v", err)
+	}
+	if len(days) != 1 || days[0].TotalSales.Cents != 900 {
+		t.Errorf("daily rollups after SyncCalendar = %+v, want one day of 900", days)
+	}
+	if _, err := db.GetSetting(ctx, calendarSetting); err != nil {
+		t.Errorf("GetSetting after SyncCalendar: %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"tacohut/models"
+)
+
+// unspecifiedMethod is the channel of records saved without a payment
+// method.
+const unspecifiedMethod = "unspecified"
+
+// ChannelFlow is the money moving through one payment channel, e.g. the
+// cash till or the M-Pesa till number, during a period. Closing is
+// Opening plus Inflow minus Outflow and is the next period's Opening.
+type ChannelFlow struct {
+	Opening  models.Money `json:"opening"`
+	Inflow   models.Money `json:"inflow"`
+	Outflow  models.Money `json:"outflow"`
+	Net      models.Money `json:"net"`
+	Closing  models.Money `json:"closing"`
+	Sales    int          `json:"sales"`
+	Expenses int          `json:"expenses"`
+}
+
+type CashFlowPeriod struct {
+	Start    time.Time              `json:"start"`
+	End      time.Time              `json:"end"`
+	Channels map[string]ChannelFlow `json:"channels"`
+	Total    ChannelFlow            `json:"total"`
+}
+
+// CashFlowReport lists every period between From and To, including those
+// without activity, so balances carry over day to day.
+type CashFlowReport struct {
+	Period   string                 `json:"period"`
+	From     time.Time              `json:"from"`
+	To       time.Time              `json:"to"`
+	Channels []string               `json:"channels"`
+	Periods  []CashFlowPeriod       `json:"periods"`
+	Summary  map[string]ChannelFlow `json:"summary"`
+}
+
+// GetCashFlow serves GET /api/reports/cashflow. Sales are inflows and
+// expenses outflows of their payment method, bucketed by period (daily,
+// weekly or monthly; default daily) over from/to, default the last
+// recentDays days widened to whole periods.
+//
+// Opening balances are everything recorded before from, plus float: the
+// money held in each channel before the first record, e.g.
+// float=cash:5000,mpesa:12000.
+func (h *Handler) GetCashFlow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "daily"
+	}
+	if _, ok := h.calendar.Period(period); !ok {
+		http.Error(w, "Invalid period", http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := h.parseRecentRange(r)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	float, err := parseTillFloat(r.URL.Query().Get("float"))
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	report, err := h.CashFlow(ctx, period, from, to, float)
+	if errors.Is(err, errRangeTooLong) {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Error building cash flow: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeAnalytics(w, report)
+}
+
+// parseTillFloat reads method:amount pairs separated by commas.
+func parseTillFloat(value string) (map[string]models.Money, error) {
+	float := make(map[string]models.Money)
+	if value == "" {
+		return float, nil
+	}
+	for _, entry := range strings.Split(value, ",") {
+		method, amount, ok := strings.Cut(entry, ":")
+		method = strings.TrimSpace(method)
+		if !ok || method == "" {
+			return nil, fmt.Errorf("float must be method:amount pairs, e.g. cash:5000")
+		}
+		money, err := models.ParseMoney(amount)
+		if err != nil {
+			return nil, fmt.Errorf("float for %s: %w", method, err)
+		}
+		float[method] = float[method].Add(money)
+	}
+	return float, nil
+}
+
+// CashFlow builds the report for the periods overlapping [from, to].
+func (h *Handler) CashFlow(ctx context.Context, period string, from, to time.Time, float map[string]models.Money) (CashFlowReport, error) {
+	from, _ = h.calculateDateRange(from, period)
+	_, to = h.calculateDateRange(to, period)
+
+	var starts, ends []time.Time
+	for t := from; !t.After(to); {
+		start, end := h.calculateDateRange(t, period)
+		if len(starts) == maxSeriesLength {
+			return CashFlowReport{}, fmt.Errorf("%w: covers more than %d %s periods", errRangeTooLong, maxSeriesLength, period)
+		}
+		starts, ends = append(starts, start), append(ends, end)
+		t = end.Add(time.Nanosecond)
+	}
+
+	salesBefore, err := h.store.Sales().SalesByMethodBefore(ctx, from)
+	if err != nil {
+		return CashFlowReport{}, fmt.Errorf("error totalling earlier sales: %w", err)
+	}
+	expensesBefore, err := h.store.Expenses().ExpensesByMethodBefore(ctx, from)
+	if err != nil {
+		return CashFlowReport{}, fmt.Errorf("error totalling earlier expenses: %w", err)
+	}
+	sales, err := h.store.Sales().SalesBetween(ctx, from, to)
+	if err != nil {
+		return CashFlowReport{}, fmt.Errorf("error reading sales: %w", err)
+	}
+	expenses, err := h.store.Expenses().ExpensesBetween(ctx, from, to)
+	if err != nil {
+		return CashFlowReport{}, fmt.Errorf("error reading expenses: %w", err)
+	}
+
+	opening := make(map[string]models.Money)
+	for method, amount := range float {
+		opening[method] = amount
+	}
+	for method, cents := range salesBefore {
+		opening[channelOf(method)] = opening[channelOf(method)].Add(models.NewMoney(cents))
+	}
+	for method, cents := range expensesBefore {
+		opening[channelOf(method)] = opening[channelOf(method)].Sub(models.NewMoney(cents))
+	}
+	flows := make([]map[string]ChannelFlow, len(starts))
+	for i := range flows {
+		flows[i] = make(map[string]ChannelFlow)
+	}
+
+	// periodOf finds the bucket holding t.
+	periodOf := func(t time.Time) int {
+		return sort.Search(len(ends), func(i int) bool { return !ends[i].Before(t) })
+	}
+
+	for _, sale := range sales {
+		method := channelOf(sale.PaymentMethod)
+		i := periodOf(sale.RecordedAt)
+		flow := flows[i][method]
+		flow.Inflow = flow.Inflow.Add(sale.Total)
+		flow.Sales++
+		flows[i][method] = flow
+	}
+	for _, expense := range expenses {
+		method := channelOf(expense.PaymentMethod)
+		i := periodOf(expense.TimeAdded)
+		flow := flows[i][method]
+		flow.Outflow = flow.Outflow.Add(expense.Amount)
+		flow.Expenses++
+		flows[i][method] = flow
+	}
+
+	seen := make(map[string]bool)
+	for method := range opening {
+		seen[method] = true
+	}
+	for _, flow := range flows {
+		for method := range flow {
+			seen[method] = true
+		}
+	}
+	channels := make([]string, 0, len(seen))
+	for method := range seen {
+		channels = append(channels, method)
+	}
+	sort.Strings(channels)
+
+	report := CashFlowReport{
+		Period:   period,
+		From:     from,
+		To:       to,
+		Channels: channels,
+		Periods:  make([]CashFlowPeriod, len(starts)),
+		Summary:  make(map[string]ChannelFlow),
+	}
+
+	balance := make(map[string]models.Money)
+	for _, method := range channels {
+		balance[method] = models.NewMoney(0).Add(opening[method])
+		report.Summary[method] = ChannelFlow{Opening: balance[method]}
+	}
+
+	for i := range starts {
+		row := CashFlowPeriod{Start: starts[i], End: ends[i], Channels: make(map[string]ChannelFlow)}
+		var total ChannelFlow
+		for _, method := range channels {
+			flow := flows[i][method]
+			flow.Opening = balance[method]
+			flow = closeFlow(flow)
+			balance[method] = flow.Closing
+			row.Channels[method] = flow
+			total = addFlow(total, flow)
+
+			summary := report.Summary[method]
+			summary.Inflow = summary.Inflow.Add(flow.Inflow)
+			summary.Outflow = summary.Outflow.Add(flow.Outflow)
+			summary.Sales += flow.Sales
+			summary.Expenses += flow.Expenses
+			report.Summary[method] = summary
+		}
+		row.Total = closeFlow(total)
+		report.Periods[i] = row
+	}
+	for method, summary := range report.Summary {
+		report.Summary[method] = closeFlow(summary)
+	}
+	return report, nil
+}
+
+func channelOf(method string) string {
+	if method == "" {
+		return unspecifiedMethod
+	}
+	return method
+}
+
+// closeFlow fills in Net and Closing from the other fields.
+func closeFlow(flow ChannelFlow) ChannelFlow {
+	flow.Opening = models.NewMoney(0).Add(flow.Opening)
+	flow.Inflow = models.NewMoney(0).Add(flow.Inflow)
+	flow.Outflow = models.NewMoney(0).Add(flow.Outflow)
+	flow.Net = flow.Inflow.Sub(flow.Outflow)
+	flow.Closing = flow.Opening.Add(flow.Net)
+	return flow
+}
+
+func addFlow(a, b ChannelFlow) ChannelFlow {
+	return ChannelFlow{
+		Opening:  a.Opening.Add(b.Opening),
+		Inflow:   a.Inflow.Add(b.Inflow),
+		Outflow:  a.Outflow.Add(b.Outflow),
+		Sales:    a.Sales + b.Sales,
+		Expenses: a.Expenses + b.Expenses,
+	}
+}
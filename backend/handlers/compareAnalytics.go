@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"tacohut/models"
+	"tacohut/store"
+)
+
+// MoneyDelta compares one money figure across two periods. Percent is
+// omitted when the previous value is zero.
+type MoneyDelta struct {
+	Current  models.Money `json:"current"`
+	Previous models.Money `json:"previous"`
+	Change   models.Money `json:"change"`
+	Percent  *float64     `json:"percent,omitempty"`
+}
+
+// CountDelta is the MoneyDelta of a count.
+type CountDelta struct {
+	Current  int      `json:"current"`
+	Previous int      `json:"previous"`
+	Change   int      `json:"change"`
+	Percent  *float64 `json:"percent,omitempty"`
+}
+
+type AnalyticsDeltas struct {
+	TotalSales        MoneyDelta            `json:"totalSales"`
+	CostOfGoods       MoneyDelta            `json:"costOfGoods"`
+	OperatingExpenses MoneyDelta            `json:"operatingExpenses"`
+	TotalExpenses     MoneyDelta            `json:"totalExpenses"`
+	GrossProfit       MoneyDelta            `json:"grossProfit"`
+	NetProfit         MoneyDelta            `json:"netProfit"`
+	TransactionCount  CountDelta            `json:"transactionCount"`
+	ItemsSold         map[string]CountDelta `json:"itemsSold"`
+	PaymentMethods    map[string]MoneyDelta `json:"paymentMethods"`
+	ExpenseCategories map[string]MoneyDelta `json:"expenseCategories"`
+}
+
+type AnalyticsComparison struct {
+	Period   string                  `json:"period"`
+	Against  string                  `json:"against"`
+	Current  models.AnalyticsSummary `json:"current"`
+	Previous models.AnalyticsSummary `json:"previous"`
+	Deltas   AnalyticsDeltas         `json:"deltas"`
+}
+
+// CompareAnalytics serves GET /api/analytics/compare. It puts the period
+// containing date (default today) next to an earlier one, chosen by
+// against:
+//
+//	previous  the period just before (default): yesterday, last month
+//	week      the same period one week earlier, e.g. same day last week
+//	year      the same period one year earlier
+func (h *Handler) CompareAnalytics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if !h.calendar.Rollup(period) {
+		http.Error(w, "Invalid period. Use: "+strings.Join(h.calendar.PeriodNames(), ", "), http.StatusBadRequest)
+		return
+	}
+
+	against := r.URL.Query().Get("against")
+	if against == "" {
+		against = "previous"
+	}
+
+	anchor := time.Now()
+	if dateParam := r.URL.Query().Get("date"); dateParam != "" {
+		var err error
+		anchor, err = h.calendar.ParseDay(dateParam)
+		if err != nil {
+			http.Error(w, "Invalid date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	comparison, err := h.ComparePeriods(ctx, period, anchor, against)
+	if errors.Is(err, errInvalidComparison) {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Error comparing %s analytics: %v", period, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeAnalytics(w, comparison)
+}
+
+var errInvalidComparison = errors.New("invalid comparison")
+
+// ComparePeriods loads the period containing anchor and the one it is
+// compared against. Missing rollups count as empty periods.
+func (h *Handler) ComparePeriods(ctx context.Context, period string, anchor time.Time, against string) (AnalyticsComparison, error) {
+	currentStart, currentEnd := h.calculateDateRange(anchor, period)
+
+	var previousAnchor time.Time
+	switch against {
+	case "previous":
+		previousAnchor = currentStart.Add(-time.Nanosecond)
+	case "week":
+		if p, _ := h.calendar.Period(period); !p.withinWeek() {
+			return AnalyticsComparison{}, fmt.Errorf("%w: against=week needs a period of a week or less", errInvalidComparison)
+		}
+		previousAnchor = currentStart.AddDate(0, 0, -7)
+	case "year":
+		previousAnchor = currentStart.AddDate(-1, 0, 0)
+	default:
+		return AnalyticsComparison{}, fmt.Errorf("%w: against must be previous, week or year", errInvalidComparison)
+	}
+	previousStart, previousEnd := h.calculateDateRange(previousAnchor, period)
+
+	current, err := h.findOrEmptyPeriod(ctx, period, currentStart, currentEnd)
+	if err != nil {
+		return AnalyticsComparison{}, err
+	}
+	previous, err := h.findOrEmptyPeriod(ctx, period, previousStart, previousEnd)
+	if err != nil {
+		return AnalyticsComparison{}, err
+	}
+
+	return AnalyticsComparison{
+		Period:   period,
+		Against:  against,
+		Current:  current,
+		Previous: previous,
+		Deltas:   compareSummaries(current, previous),
+	}, nil
+}
+
+func (h *Handler) findOrEmptyPeriod(ctx context.Context, period string, startDate, endDate time.Time) (models.AnalyticsSummary, error) {
+	summary, err := h.store.Periods().FindPeriod(ctx, period, startDate, endDate)
+	if errors.Is(err, store.ErrNotFound) {
+		return emptySummary(period, startDate, endDate), nil
+	}
+	return summary, err
+}
+
+func compareSummaries(current, previous models.AnalyticsSummary) AnalyticsDeltas {
+	deltas := AnalyticsDeltas{
+		TotalSales:        moneyDelta(current.TotalSales, previous.TotalSales),
+		CostOfGoods:       moneyDelta(current.CostOfGoods, previous.CostOfGoods),
+		OperatingExpenses: moneyDelta(current.OperatingExpenses, previous.OperatingExpenses),
+		TotalExpenses:     moneyDelta(current.TotalExpenses, previous.TotalExpenses),
+		GrossProfit:       moneyDelta(current.GrossProfit, previous.GrossProfit),
+		NetProfit:         moneyDelta(current.NetProfit, previous.NetProfit),
+		TransactionCount:  countDelta(current.TransactionCount, previous.TransactionCount),
+		ItemsSold:         make(map[string]CountDelta),
+		PaymentMethods:    make(map[string]MoneyDelta),
+		ExpenseCategories: make(map[string]MoneyDelta),
+	}
+
+	for item := range current.ItemsSold {
+		deltas.ItemsSold[item] = countDelta(current.ItemsSold[item], previous.ItemsSold[item])
+	}
+	for item := range previous.ItemsSold {
+		deltas.ItemsSold[item] = countDelta(current.ItemsSold[item], previous.ItemsSold[item])
+	}
+	for method := range current.PaymentMethods {
+		deltas.PaymentMethods[method] = moneyDelta(current.PaymentMethods[method], previous.PaymentMethods[method])
+	}
+	for method := range previous.PaymentMethods {
+		deltas.PaymentMethods[method] = moneyDelta(current.PaymentMethods[method], previous.PaymentMethods[method])
+	}
+	for category := range current.ExpenseCategories {
+		deltas.ExpenseCategories[category] = moneyDelta(current.ExpenseCategories[category], previous.ExpenseCategories[category])
+	}
+	for category := range previous.ExpenseCategories {
+		deltas.ExpenseCategories[category] = moneyDelta(current.ExpenseCategories[category], previous.ExpenseCategories[category])
+	}
+	return deltas
+}
+
+func moneyDelta(current, previous models.Money) MoneyDelta {
+	return MoneyDelta{
+		Current:  current,
+		Previous: previous,
+		Change:   current.Sub(previous),
+		Percent:  percentChange(current.Cents, previous.Cents),
+	}
+}
+
+func countDelta(current, previous int) CountDelta {
+	return CountDelta{
+		Current:  current,
+		Previous: previous,
+		Change:   current - previous,
+		Percent:  percentChange(int64(current), int64(previous)),
+	}
+}
+
+// percentChange is the change relative to the magnitude of previous,
+// rounded to two decimals, or nil when there is nothing to compare with.
+func percentChange(current, previous int64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	p := float64(current-previous) / math.Abs(float64(previous)) * 100
+	p = math.Round(p*100) / 100
+	return &p
+}
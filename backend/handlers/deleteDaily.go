@@ -3,17 +3,18 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
-	"tacohut/middlewares"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
-    "go.mongodb.org/mongo-driver/bson/primitive"
+	"tacohut/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func DeleteDaily(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteDaily(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "DELETE" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -22,28 +23,22 @@ func DeleteDaily(w http.ResponseWriter, r *http.Request) {
 	pathSegments := strings.Split(r.URL.Path, "/")
 	id := pathSegments[len(pathSegments)-1]
 
-	fmt.Println("Trying to delete expense item with id:", id)
-
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		http.Error(w, "Invalid ID format", http.StatusBadRequest)
 		return
 	}
 
-	collection := middlewares.ExpensesDB.Collection("dailyExpenses")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := collection.DeleteOne(ctx, bson.M{"_id": objID})
-	if err != nil {
-		http.Error(w, "Error deleting sale", http.StatusInternalServerError)
+	err = h.store.Daily().DeleteDay(ctx, objID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Daily analysis not found", http.StatusNotFound)
 		return
-	}
-
-	fmt.Println("Delete result:", result)
-
-	if result.DeletedCount == 0 {
-		http.Error(w, "Sale not found", http.StatusNotFound)
+	} else if err != nil {
+		log.Printf("Error deleting daily analysis %s: %v", id, err)
+		http.Error(w, "Error deleting daily analysis", http.StatusInternalServerError)
 		return
 	}
 
@@ -54,4 +49,4 @@ func DeleteDaily(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+}
@@ -3,18 +3,21 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
-	"tacohut/middlewares"
+	"tacohut/models"
+	"tacohut/store"
 
-	"go.mongodb.org/mongo-driver/bson"
-    "go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func DeleteExpenses(w http.ResponseWriter, r *http.Request) {
+// DeleteExpenses voids an expense and takes it out of its day's rollup. See
+// DeleteSale for the request body.
+func (h *Handler) DeleteExpenses(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "DELETE" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -23,36 +26,69 @@ func DeleteExpenses(w http.ResponseWriter, r *http.Request) {
 	pathSegments := strings.Split(r.URL.Path, "/")
 	id := pathSegments[len(pathSegments)-1]
 
-	fmt.Println("Trying to delete expense item with id:", id)
-
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		http.Error(w, "Invalid ID format", http.StatusBadRequest)
 		return
 	}
 
-	collection := middlewares.ExpensesDB.Collection("dailyExpense")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	result, err := collection.DeleteOne(ctx, bson.M{"_id": objID})
+	void, err := readVoid(r)
 	if err != nil {
-		http.Error(w, "Error deleting sale", http.StatusInternalServerError)
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	fmt.Println("Delete result:", result)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var expense models.ExpensesFetched
+	err = h.store.RunInTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		expense, err = h.store.Expenses().FindExpense(ctx, objID)
+		if err != nil {
+			return err
+		}
+		if expense.Voided != nil {
+			return errAlreadyVoided
+		}
 
-	if result.DeletedCount == 0 {
-	    http.Error(w, "Sale not found", http.StatusNotFound)
-	    return
+		if err := h.store.Expenses().SetExpenseVoid(ctx, objID, void); err != nil {
+			return err
+		}
+		return h.applyExpense(ctx, expenseOf(expense), -1)
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Expense not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, errAlreadyVoided) {
+		http.Error(w, "Expense is already voided", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error voiding expense %s: %v", id, err)
+		http.Error(w, "Error deleting expense", http.StatusInternalServerError)
+		return
 	}
 
+	expense.Voided = void
+	h.detectAfterExpense(expense)
+
 	response := map[string]interface{}{
-	    "status":  "success",
-	    "message": "Deleted",
+		"status":  "success",
+		"message": "Deleted",
+		"voided":  void,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+}
+
+// expenseOf returns the fields of a stored expense that feed analytics.
+func expenseOf(expense models.ExpensesFetched) models.Expenses {
+	return models.Expenses{
+		Amount:        expense.Amount,
+		Category:      expense.Category,
+		Description:   expense.Description,
+		PaymentMethod: expense.PaymentMethod,
+		TimeAdded:     expense.TimeAdded,
+	}
+}
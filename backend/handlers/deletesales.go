@@ -3,55 +3,108 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
+	"log"
 	"net/http"
 	"strings"
-	"tacohut/middlewares"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
-    "go.mongodb.org/mongo-driver/bson/primitive"
+	"tacohut/models"
+	"tacohut/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func DeleteSale(w http.ResponseWriter, r *http.Request) {
-if r.Method != "DELETE" {
-    http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-    return
-}
+// errAlreadyVoided and errNotVoided reject voiding or restoring a record
+// twice, which would apply its analytics delta twice.
+var (
+	errAlreadyVoided = errors.New("already voided")
+	errNotVoided     = errors.New("not voided")
+)
 
-pathSegments := strings.Split(r.URL.Path, "/")
-id := pathSegments[len(pathSegments)-1]
+// DeleteSale voids a sale rather than deleting it. The optional JSON body
+// records who voided it and why; the sale is taken out of every rollup and
+// can be brought back with RestoreSale.
+func (h *Handler) DeleteSale(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-fmt.Println("Trying to delete sales item with id:", id)
+	pathSegments := strings.Split(r.URL.Path, "/")
+	id := pathSegments[len(pathSegments)-1]
 
-objID, err := primitive.ObjectIDFromHex(id)
-if err != nil {
-    http.Error(w, "Invalid ID format", http.StatusBadRequest)
-    return
-}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
 
-collection := middlewares.TacoDB.Collection("dailysales")
-ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-defer cancel()
+	void, err := readVoid(r)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
-result, err := collection.DeleteOne(ctx, bson.M{"_id": objID})
-if err != nil {
-    http.Error(w, "Error deleting sale", http.StatusInternalServerError)
-    return
-}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-fmt.Println("Delete result:", result)
+	var sale models.SalesData
+	err = h.store.RunInTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		sale, err = h.store.Sales().FindSale(ctx, objID)
+		if err != nil {
+			return err
+		}
+		if sale.Voided != nil {
+			return errAlreadyVoided
+		}
 
-if result.DeletedCount == 0 {
-    http.Error(w, "Sale not found", http.StatusNotFound)
-    return
-}
+		if err := h.store.Sales().SetSaleVoid(ctx, objID, void); err != nil {
+			return err
+		}
+		return h.applySale(ctx, sale, -1)
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Sale not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, errAlreadyVoided) {
+		http.Error(w, "Sale is already voided", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error voiding sale %s: %v", id, err)
+		http.Error(w, "Error deleting sale", http.StatusInternalServerError)
+		return
+	}
+
+	sale.Voided = void
+	h.detectAfterSale(sale)
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Deleted",
+		"voided":  void,
+	}
 
-response := map[string]interface{}{
-    "status":  "success",
-    "message": "Deleted",
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
-w.Header().Set("Content-Type", "application/json")
-json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+// readVoid builds the void record for a delete request. The body is
+// optional so existing clients that send a bare DELETE keep working.
+func readVoid(r *http.Request) (*models.Void, error) {
+	var body struct {
+		VoidedBy string `json:"voidedBy"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return &models.Void{
+		VoidedAt: time.Now(),
+		VoidedBy: strings.TrimSpace(body.VoidedBy),
+		Reason:   strings.TrimSpace(body.Reason),
+	}, nil
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"tacohut/models"
+	"tacohut/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FetchAnomalies serves GET /api/anomalies, the alerts list. status is
+// open (default, not yet acknowledged) or all; severity narrows it to
+// critical or warning.
+func (h *Handler) FetchAnomalies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var q store.AnomalyQuery
+	switch r.URL.Query().Get("status") {
+	case "", "open":
+		q.Open = true
+	case "all":
+	default:
+		http.Error(w, "Invalid status. Use: open, all", http.StatusBadRequest)
+		return
+	}
+
+	switch severity := r.URL.Query().Get("severity"); severity {
+	case "", models.SeverityCritical, models.SeverityWarning:
+		q.Severity = severity
+	default:
+		http.Error(w, "Invalid severity. Use: critical, warning", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.Limit = limit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	anomalies, err := h.store.Anomalies().ListAnomalies(ctx, q)
+	if err != nil {
+		log.Printf("Error fetching anomalies: %v", err)
+		http.Error(w, "Failed to fetch anomalies", http.StatusInternalServerError)
+		return
+	}
+	writeAnalytics(w, anomalies)
+}
+
+// AcknowledgeAnomaly serves POST /api/anomalies/{id}/acknowledge. An
+// acknowledged anomaly leaves the open list but stays acknowledged if the
+// detector flags the same thing again.
+func (h *Handler) AcknowledgeAnomaly(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pathSegments := strings.Split(strings.TrimSuffix(r.URL.Path, "/acknowledge"), "/")
+	id := pathSegments[len(pathSegments)-1]
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = h.store.Anomalies().AcknowledgeAnomaly(ctx, objID, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Anomaly not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error acknowledging anomaly %s: %v", id, err)
+		http.Error(w, "Error acknowledging anomaly", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Acknowledged",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ScanAnomaliesHandler serves POST /api/admin/anomalies/scan, running the
+// scheduled scan now over from/to, by default the last anomalyScanDays
+// days.
+func (h *Handler) ScanAnomaliesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to := h.anomalyScanRange()
+	if r.URL.Query().Has("from") || r.URL.Query().Has("to") {
+		var err error
+		from, to, err = h.parseDateRange(r)
+		if err != nil {
+			http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	scan, err := h.ScanAnomalies(ctx, from, to)
+	if err != nil {
+		log.Printf("Error scanning for anomalies: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeAnalytics(w, scan)
+}
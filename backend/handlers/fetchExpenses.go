@@ -1,78 +1,60 @@
 package handlers
 
 import (
-	"net/http"
-	//"fmt"
 	"context"
 	"encoding/json"
 	"log"
+	"net/http"
 	"time"
 
-	"tacohut/middlewares"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"tacohut/models"
+	"tacohut/store"
 )
 
-type ExpensesFetched struct {
-	ID interface{}       `bson:"_id,omitempty"`
-	Amount string        `json:"amount" bson:"amount"`
-	Category string      `json:"category" bson:"category"`
-	Description string   `json:"description" bson:"description"`
-	PaymentMethod string `json:"paymentMethod" bson:"paymentMethod"`
-	TimeAdded time.Time  `json:"timeAdded" bson:"timeAdded"`
-}
-
-func FetchExpenses(w http.ResponseWriter, r *http.Request) {
+// FetchExpenses lists expenses newest first, one page at a time, with a
+// per-category footer for the whole filtered set.
+//
+// Query parameters, all optional:
+//
+//	from, to        timeAdded range, YYYY-MM-DD or RFC 3339
+//	category        exact category
+//	paymentMethod   exact payment method
+//	q               description substring
+//	order           desc (default) or asc
+//	limit           page size, default 100; every expense when neither
+//	                limit nor cursor is given
+//	cursor          the "next" token from the previous page
+func (h *Handler) FetchExpenses(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if middlewares.ExpensesDB == nil {
-		log.Println("Database connection is nil")
-		http.Error(w, "Database connection error", http.StatusInternalServerError)
+	query, err := h.parseExpenseQuery(r)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	
-	
-	collection := middlewares.ExpensesDB.Collection("dailyExpense")
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	count , err := collection.CountDocuments(ctx, bson.M{})
-	if err != nil {
-		log.Printf("Count error %v", err)
-	} else {
-		log.Printf("Sales items: %d", count)
-	}
-
-	var rawDoc bson.M
-	if err := collection.FindOne(ctx, bson.M{}).Decode(&rawDoc); err != nil {
-		log.Printf("Debug findOne error: %v", err)
-	} else {
-		log.Printf("Sample document structure: %+v", rawDoc)
-	}
-
-	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
-	cursor, err := collection.Find(ctx, bson.M{}, findOptions)
+	page, err := h.store.Expenses().ListExpenses(ctx, query)
 	if err != nil {
-		log.Printf("Error fetching portfolio items: %v", err)
-		http.Error(w, "Failed to fetch portfolio items", http.StatusInternalServerError)
+		log.Printf("Error fetching expenses: %v", err)
+		http.Error(w, "Failed to fetch expenses", http.StatusInternalServerError)
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var expenses []ExpensesFetched
-	if err = cursor.All(ctx, &expenses); err != nil {
-		log.Printf("Error decoding portfolio items: %v", err)
-		http.Error(w, "Failed to decode portfolio items", http.StatusInternalServerError)
-		return
+	if page.Expenses == nil {
+		page.Expenses = []models.ExpensesFetched{}
 	}
-
 	response := map[string]interface{}{
-		"status": "success",
-		"data": expenses,
+		"status":     "success",
+		"data":       page.Expenses,
+		"count":      page.Total,
+		"categories": page.Categories,
+		"next":       encodeCursor(page.Next, "timeAdded", query.Descending),
 	}
 	w.Header().Set("Content-Type", "application/json")
 
@@ -80,4 +62,31 @@ func FetchExpenses(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error encoding response: %v", err)
 		http.Error(w, "Internal server error: Could not encode response", http.StatusInternalServerError)
 	}
-}
\ No newline at end of file
+}
+
+func (h *Handler) parseExpenseQuery(r *http.Request) (store.ExpenseQuery, error) {
+	params := r.URL.Query()
+	q := store.ExpenseQuery{
+		Category:      params.Get("category"),
+		PaymentMethod: params.Get("paymentMethod"),
+		Description:   params.Get("q"),
+	}
+
+	var err error
+	if q.From, err = h.parseTimeParam(r, "from", false); err != nil {
+		return q, err
+	}
+	if q.To, err = h.parseTimeParam(r, "to", true); err != nil {
+		return q, err
+	}
+	if q.Descending, err = parseOrder(r); err != nil {
+		return q, err
+	}
+	if q.Limit, err = parseListLimit(r); err != nil {
+		return q, err
+	}
+	if q.After, err = decodeCursor(params.Get("cursor"), "timeAdded", q.Descending); err != nil {
+		return q, err
+	}
+	return q, nil
+}
@@ -3,69 +3,103 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	//"fmt"
+	"fmt"
 	"log"
 	"net/http"
-	"tacohut/middlewares"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"tacohut/models"
+	"tacohut/store"
 )
 
-func FetchSaleData(w http.ResponseWriter, r *http.Request) {
+// FetchSaleData lists sales newest first, one page at a time.
+//
+// Query parameters, all optional:
+//
+//	from, to            recordedAt range, YYYY-MM-DD or RFC 3339
+//	paymentMethod       exact payment method
+//	item                sales containing an item with this name
+//	minTotal, maxTotal  total range in major units
+//	sort                recordedAt (default) or total
+//	order               desc (default) or asc
+//	limit               page size, default 100; every sale when neither
+//	                    limit nor cursor is given
+//	cursor              the "next" token from the previous page
+func (h *Handler) FetchSaleData(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if middlewares.TacoDB == nil {
-		log.Println("Database connection is nil")
-		http.Error(w, "Database connection error", http.StatusInternalServerError)
+	query, err := h.parseSalesQuery(r)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	
-	collection := middlewares.TacoDB.Collection("dailysales")
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	count , err := collection.CountDocuments(ctx, bson.M{})
+	page, err := h.store.Sales().ListSales(ctx, query)
 	if err != nil {
-		log.Printf("Count error %v", err)
-	} else {
-		log.Printf("Sales items: %d", count)
-	}
-
-	var rawDoc bson.M
-	if err := collection.FindOne(ctx, bson.M{}).Decode(&rawDoc); err != nil {
-		log.Printf("Debug findOne error: %v", err)
-	} else {
-		log.Printf("Sample document structure: %+v", rawDoc)
-	}
-
-	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
-	cursor, err := collection.Find(ctx, bson.M{}, findOptions)
-	if err != nil {
-		log.Printf("Error fetching portfolio items: %v", err)
-		http.Error(w, "Failed to fetch portfolio items", http.StatusInternalServerError)
+		log.Printf("Error fetching sales: %v", err)
+		http.Error(w, "Failed to fetch sales", http.StatusInternalServerError)
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var salesItems []Sales
-	if err = cursor.All(ctx, &salesItems); err != nil {
-		log.Printf("Error decoding portfolio items: %v", err)
-		http.Error(w, "Failed to decode portfolio items", http.StatusInternalServerError)
-		return
+	if page.Sales == nil {
+		page.Sales = []models.SalesData{}
 	}
-
 	response := map[string]interface{}{
 		"status": "success",
-		"data": salesItems,
+		"data":   page.Sales,
+		"count":  page.Total,
+		"next":   encodeCursor(page.Next, query.SortBy, query.Descending),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Error encoding response: %v", err)
 		http.Error(w, "Internal server error: Could not encode response", http.StatusInternalServerError)
 	}
-}
\ No newline at end of file
+}
+
+func (h *Handler) parseSalesQuery(r *http.Request) (store.SalesQuery, error) {
+	params := r.URL.Query()
+	q := store.SalesQuery{
+		PaymentMethod: params.Get("paymentMethod"),
+		ItemName:      params.Get("item"),
+		SortBy:        params.Get("sort"),
+	}
+
+	switch q.SortBy {
+	case "":
+		q.SortBy = store.SortRecordedAt
+	case store.SortRecordedAt, store.SortTotal:
+	default:
+		return q, fmt.Errorf("sort must be %s or %s", store.SortRecordedAt, store.SortTotal)
+	}
+
+	var err error
+	if q.From, err = h.parseTimeParam(r, "from", false); err != nil {
+		return q, err
+	}
+	if q.To, err = h.parseTimeParam(r, "to", true); err != nil {
+		return q, err
+	}
+	if q.MinTotal, err = parseMoneyParam(r, "minTotal"); err != nil {
+		return q, err
+	}
+	if q.MaxTotal, err = parseMoneyParam(r, "maxTotal"); err != nil {
+		return q, err
+	}
+	if q.Descending, err = parseOrder(r); err != nil {
+		return q, err
+	}
+	if q.Limit, err = parseListLimit(r); err != nil {
+		return q, err
+	}
+	if q.After, err = decodeCursor(params.Get("cursor"), q.SortBy, q.Descending); err != nil {
+		return q, err
+	}
+	return q, nil
+}
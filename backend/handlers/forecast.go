@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"tacohut/forecast"
+	"tacohut/models"
+)
+
+const (
+	defaultForecastDays    = 14
+	maxForecastDays        = 60
+	defaultForecastHistory = 182
+	maxForecastHistory     = 730
+	// forecastContextDays of actuals are returned with a forecast so a
+	// chart can draw the two together.
+	forecastContextDays = 28
+	weekDays            = 7
+)
+
+// SalesBand is a forecast amount with its 80% and 95% prediction
+// intervals.
+type SalesBand struct {
+	Forecast models.Money `json:"forecast"`
+	Lower80  models.Money `json:"lower80"`
+	Upper80  models.Money `json:"upper80"`
+	Lower95  models.Money `json:"lower95"`
+	Upper95  models.Money `json:"upper95"`
+}
+
+// QuantityBand is the SalesBand of an item quantity, to one decimal.
+type QuantityBand struct {
+	Forecast float64 `json:"forecast"`
+	Lower80  float64 `json:"lower80"`
+	Upper80  float64 `json:"upper80"`
+	Lower95  float64 `json:"lower95"`
+	Upper95  float64 `json:"upper95"`
+}
+
+type ForecastDay struct {
+	Date  time.Time `json:"date"`
+	Sales SalesBand `json:"sales"`
+}
+
+type ActualDay struct {
+	Date  time.Time    `json:"date"`
+	Sales models.Money `json:"sales"`
+}
+
+type ItemForecast struct {
+	Name   string         `json:"name"`
+	Method string         `json:"method"`
+	Total  float64        `json:"total"` // over the whole horizon
+	Days   []QuantityBand `json:"days"`  // one per SalesForecast.Days
+}
+
+// SalesForecast predicts daily sales and item quantities from the daily
+// rollups. Method is holt-winters with a weekly season once there are two
+// weeks of history, and a plainer model before that.
+type SalesForecast struct {
+	Method      string         `json:"method"`
+	HistoryFrom time.Time      `json:"historyFrom"`
+	HistoryTo   time.Time      `json:"historyTo"`
+	HistoryDays int            `json:"historyDays"`
+	Actuals     []ActualDay    `json:"actuals"`
+	Days        []ForecastDay  `json:"days"`
+	Items       []ItemForecast `json:"items"`
+}
+
+// GetSalesForecast serves GET /api/analytics/forecast. days (default 14)
+// is the horizon starting today and history (default 182) how many past
+// days the models are fitted on.
+func (h *Handler) GetSalesForecast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days, err := parseDays(r, "days", defaultForecastDays, maxForecastDays)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	history, err := parseDays(r, "history", defaultForecastHistory, maxForecastHistory)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := h.SalesForecast(ctx, time.Now(), history, days)
+	if err != nil {
+		log.Printf("Error forecasting sales: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeAnalytics(w, result)
+}
+
+func parseDays(r *http.Request, name string, fallback, max int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > max {
+		return 0, fmt.Errorf("%s must be between 1 and %d", name, max)
+	}
+	return n, nil
+}
+
+// SalesForecast fits on the history days before the business day holding
+// now and forecasts horizon days from that day on. Today is left out of
+// the history because it is not over yet. Days before the first recorded
+// sale are not history; days after it without sales count as zero.
+func (h *Handler) SalesForecast(ctx context.Context, now time.Time, history, horizon int) (SalesForecast, error) {
+	today := h.calendar.DayStart(now)
+	from := h.calendar.DayStart(today.AddDate(0, 0, -history))
+
+	days, err := h.dailyHistory(ctx, from, today.Add(-time.Nanosecond))
+	if err != nil {
+		return SalesForecast{}, err
+	}
+
+	var dates []time.Time
+	for d := from; d.Before(today); d = h.nextDay(d) {
+		dates = append(dates, d)
+	}
+	first := len(dates)
+	for i, d := range dates {
+		if _, ok := days[d.UTC()]; ok {
+			first = i
+			break
+		}
+	}
+	dates = dates[first:]
+
+	sales := make([]float64, len(dates))
+	quantities := make(map[string][]float64)
+	for i, d := range dates {
+		day := days[d.UTC()]
+		sales[i] = float64(day.TotalSales.Cents)
+		for name, quantity := range day.ItemsSold {
+			if quantities[name] == nil {
+				quantities[name] = make([]float64, len(dates))
+			}
+			quantities[name][i] = float64(quantity)
+		}
+	}
+
+	result := SalesForecast{
+		HistoryDays: len(dates),
+		Actuals:     []ActualDay{},
+		Days:        []ForecastDay{},
+		Items:       []ItemForecast{},
+	}
+	if len(dates) > 0 {
+		result.HistoryFrom = dates[0]
+		result.HistoryTo = today.Add(-time.Nanosecond)
+	}
+	for i := max(0, len(dates)-forecastContextDays); i < len(dates); i++ {
+		result.Actuals = append(result.Actuals, ActualDay{Date: dates[i], Sales: models.NewMoney(int64(sales[i]))})
+	}
+
+	fit := forecast.Seasonal(sales, weekDays, horizon)
+	result.Method = fit.Method
+	day := today
+	for _, p := range fit.Points {
+		result.Days = append(result.Days, ForecastDay{Date: day, Sales: salesBand(p)})
+		day = h.nextDay(day)
+	}
+
+	for name, series := range quantities {
+		fit := forecast.Seasonal(series, weekDays, horizon)
+		item := ItemForecast{Name: name, Method: fit.Method, Days: make([]QuantityBand, len(fit.Points))}
+		for i, p := range fit.Points {
+			item.Days[i] = quantityBand(p)
+			item.Total += p.Value
+		}
+		item.Total = math.Round(item.Total*10) / 10
+		result.Items = append(result.Items, item)
+	}
+	sort.Slice(result.Items, func(i, j int) bool {
+		a, b := result.Items[i], result.Items[j]
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return a.Name < b.Name
+	})
+	return result, nil
+}
+
+// nextDay returns the start of the business day after the one holding t.
+func (h *Handler) nextDay(t time.Time) time.Time {
+	_, end := h.calculateDateRange(t, "daily")
+	return end.Add(time.Nanosecond)
+}
+
+// dailyHistory reads one summary per business day in [from, to], keyed by
+// the day's start in UTC. It uses the daily period rollups when they are
+// kept and the dailyAnalysis documents otherwise.
+func (h *Handler) dailyHistory(ctx context.Context, from, to time.Time) (map[time.Time]models.AnalyticsSummary, error) {
+	days := make(map[time.Time]models.AnalyticsSummary)
+
+	if h.calendar.Rollup("daily") {
+		summaries, err := h.store.Periods().PeriodsBetween(ctx, "daily", from, to)
+		if err != nil {
+			return nil, fmt.Errorf("error reading daily analytics: %w", err)
+		}
+		for _, summary := range summaries {
+			days[summary.StartDate.UTC()] = summary
+		}
+		return days, nil
+	}
+
+	all, err := h.store.Daily().DaysBetween(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error reading daily analysis: %w", err)
+	}
+	for _, day := range all {
+		days[h.calendar.DayStart(day.Date).UTC()] = models.AnalyticsSummary{
+			StartDate:  day.Date,
+			ItemsSold:  day.ItemsSold,
+			TotalSales: day.TotalSales,
+		}
+	}
+	return days, nil
+}
+
+func salesBand(p forecast.Point) SalesBand {
+	cents := func(v float64) models.Money { return models.NewMoney(int64(math.Round(v))) }
+	return SalesBand{
+		Forecast: cents(p.Value),
+		Lower80:  cents(p.Lower80),
+		Upper80:  cents(p.Upper80),
+		Lower95:  cents(p.Lower95),
+		Upper95:  cents(p.Upper95),
+	}
+}
+
+func quantityBand(p forecast.Point) QuantityBand {
+	round := func(v float64) float64 { return math.Round(v*10) / 10 }
+	return QuantityBand{
+		Forecast: round(p.Value),
+		Lower80:  round(p.Lower80),
+		Upper80:  round(p.Upper80),
+		Lower95:  round(p.Lower95),
+		Upper95:  round(p.Upper95),
+	}
+}
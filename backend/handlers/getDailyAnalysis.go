@@ -3,101 +3,100 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"time"
 
-	"tacohut/middlewares"
+	"tacohut/models"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// DailyAnalyticsResponse is one rollup as sent to the dashboard. The
+// payment map holds transaction counts for days and amounts for periods.
 type DailyAnalyticsResponse struct {
-	ID               string            `json:"id"`
-	Date             string            `json:"date"`
-	ItemsSold        map[string]int    `json:"itemsSold"`
-	PaymentMethods   map[string]int    `json:"paymentMethods"` // for receiving
-	TotalSales       int               `json:"totalSales"`
-	TotalExpenses    int               `json:"totalExpenses"`
-	NetProfit        int               `json:"netProfit"`
-	ExpenseCategories map[string]int   `json:"expenseCategories"`
-	LastUpdated      string            `json:"lastUpdated"`
+	ID                string                  `json:"id"`
+	Date              string                  `json:"date"`
+	ItemsSold         map[string]int          `json:"itemsSold"`
+	PaymentMethods    interface{}             `json:"paymentMethods"` // for receiving
+	TotalSales        models.Money            `json:"totalSales"`
+	TotalExpenses     models.Money            `json:"totalExpenses"`
+	NetProfit         models.Money            `json:"netProfit"`
+	ExpenseCategories map[string]models.Money `json:"expenseCategories"`
+	LastUpdated       string                  `json:"lastUpdated"`
 }
 
+// FinalResponse keeps the dashboard's weekly, monthly and yearly lists;
+// any other configured rollups, e.g. quarterly, are listed under
+// OtherAnalytics by period name.
 type FinalResponse struct {
-	DailyAnalytics  []DailyAnalyticsResponse `json:"dailyAnalytics"`
-	WeeklyAnalytics  []DailyAnalyticsResponse `json:"weeklyAnalytics"`
-	MonthlyAnalytics []DailyAnalyticsResponse `json:"monthlyAnalytics"`
-	YearlyAnalytics  []DailyAnalyticsResponse `json:"yearlyAnalytics"`
+	DailyAnalytics   []DailyAnalyticsResponse            `json:"dailyAnalytics"`
+	WeeklyAnalytics  []DailyAnalyticsResponse            `json:"weeklyAnalytics"`
+	MonthlyAnalytics []DailyAnalyticsResponse            `json:"monthlyAnalytics"`
+	YearlyAnalytics  []DailyAnalyticsResponse            `json:"yearlyAnalytics"`
+	OtherAnalytics   map[string][]DailyAnalyticsResponse `json:"otherAnalytics,omitempty"`
 }
 
-// Define the DailyData struct that matches your MongoDB documents
-// type DailyData struct {
-// 	ID             interface{}    `bson:"_id,omitempty"`
-// 	Date           time.Time      `bson:"date"`
-// 	ItemsSold      map[string]int `bson:"itemsSold"`
-// 	PaymentSummary map[string]int `bson:"paymentSummary"`
-// 	TotalSales     int            `bson:"totalSales"`
-// 	TotalExpenses  int            `bson:"totalExpenses"`
-// 	NetProfit      int            `bson:"netProfit"`
-// 	ExpenseCategory map[string]int `bson:"expenseCategory"`
-// 	LastUpdated    time.Time      `bson:"lastUpdated"`
-// }
-
-func FetchDailyAnalysis(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) FetchDailyAnalysis(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" || r.URL.Path != "/api/daily" {
 		http.Error(w, "Method not allowed!", http.StatusMethodNotAllowed)
 		return
 	}
 
-	analyticsConfigs := []struct {
-		db         *mongo.Database
-		collection string
-	}{
-		{middlewares.DailyAnalytics, "dailyAnalysis"},
-		{middlewares.WeeklyAnalytics, "weeklyAnalytics"},
-		{middlewares.MonthlyAnalytics, "monthlyAnalytics"},
-		{middlewares.YearlyAnalytics, "yearlyAnalytics"},
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	days, err := h.store.Daily().ListDays(ctx)
+	if err != nil {
+		log.Printf("Error mapping data for dailyAnalysis: %v", err)
+		http.Error(w, "Failed to process analytics data", http.StatusInternalServerError)
+		return
+	}
+
+	finalResponse := FinalResponse{
+		DailyAnalytics: MappingDailyData(days),
 	}
 
-	finalResponse := FinalResponse{}
+	periodTargets := []struct {
+		period string
+		target *[]DailyAnalyticsResponse
+	}{
+		{"weekly", &finalResponse.WeeklyAnalytics},
+		{"monthly", &finalResponse.MonthlyAnalytics},
+		{"yearly", &finalResponse.YearlyAnalytics},
+	}
 
-	for index, config := range analyticsConfigs {
-		if config.db == nil {
-			log.Printf("Database connection for index %d is nil", index)
-			http.Error(w, "Database connection error", http.StatusInternalServerError)
+	for _, pt := range periodTargets {
+		summaries, err := h.store.Periods().ListPeriods(ctx, pt.period)
+		if err != nil {
+			log.Printf("Error mapping data for %sAnalytics: %v", pt.period, err)
+			http.Error(w, "Failed to process analytics data", http.StatusInternalServerError)
 			return
 		}
+		*pt.target = MappingPeriodData(summaries)
+	}
 
-		collection := config.db.Collection(config.collection)
-		data, err := MappingDailyData(collection, index)
-		
+	for _, period := range h.calendar.PeriodNames() {
+		switch period {
+		case "daily", "weekly", "monthly", "yearly":
+			continue
+		}
+		summaries, err := h.store.Periods().ListPeriods(ctx, period)
 		if err != nil {
-			log.Printf("Error mapping data for %s: %v", config.collection, err)
+			log.Printf("Error mapping data for %sAnalytics: %v", period, err)
 			http.Error(w, "Failed to process analytics data", http.StatusInternalServerError)
 			return
 		}
-
-		switch index {
-		case 0:
-			finalResponse.DailyAnalytics = data
-		case 1:
-			finalResponse.WeeklyAnalytics = data
-		case 2:
-			finalResponse.MonthlyAnalytics = data
-		case 3:
-			finalResponse.YearlyAnalytics = data
+		if finalResponse.OtherAnalytics == nil {
+			finalResponse.OtherAnalytics = make(map[string][]DailyAnalyticsResponse)
 		}
+		finalResponse.OtherAnalytics[period] = MappingPeriodData(summaries)
 	}
 
 	response := map[string]interface{}{
 		"status": "success",
 		"data":   finalResponse,
-		"count":  4,
+		"count":  4 + len(finalResponse.OtherAnalytics),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -107,25 +106,10 @@ func FetchDailyAnalysis(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func MappingDailyData(collection *mongo.Collection, index int) ([]DailyAnalyticsResponse, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	findOptions := options.Find().SetSort(bson.D{{Key: "date", Value: -1}})
-	cursor, err := collection.Find(ctx, bson.M{}, findOptions)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching analytics: %w", err)
-	}
-	defer cursor.Close(ctx)
-
-	var mongoData []DailyData
-	if err = cursor.All(ctx, &mongoData); err != nil {
-		return nil, fmt.Errorf("error decoding analytics: %w", err)
-	}
-
-	tsResponse := make([]DailyAnalyticsResponse, len(mongoData))
+func MappingDailyData(days []models.DailyData) []DailyAnalyticsResponse {
+	tsResponse := make([]DailyAnalyticsResponse, len(days))
 
-	for i, data := range mongoData {
+	for i, data := range days {
 		idStr := ""
 		if objID, ok := data.ID.(primitive.ObjectID); ok {
 			idStr = objID.Hex()
@@ -146,5 +130,25 @@ func MappingDailyData(collection *mongo.Collection, index int) ([]DailyAnalytics
 		}
 	}
 
-	return tsResponse, nil
-}
\ No newline at end of file
+	return tsResponse
+}
+
+func MappingPeriodData(summaries []models.AnalyticsSummary) []DailyAnalyticsResponse {
+	tsResponse := make([]DailyAnalyticsResponse, len(summaries))
+
+	for i, data := range summaries {
+		tsResponse[i] = DailyAnalyticsResponse{
+			ID:                data.ID.Hex(),
+			Date:              data.StartDate.Format(time.RFC3339),
+			ItemsSold:         data.ItemsSold,
+			PaymentMethods:    data.PaymentMethods,
+			TotalSales:        data.TotalSales,
+			TotalExpenses:     data.TotalExpenses,
+			NetProfit:         data.NetProfit,
+			ExpenseCategories: data.ExpenseCategories,
+			LastUpdated:       data.LastUpdated.Format(time.RFC3339),
+		}
+	}
+
+	return tsResponse
+}
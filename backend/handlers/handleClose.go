@@ -1,13 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
-	"tacohut/middlewares"
+	"time"
 )
 
-func HandleClose(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleClose(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Closing app and database...")
 
-	middlewares.CloseDB()
-}
\ No newline at end of file
+	// Let anomaly checks for earlier writes finish before the store goes.
+	h.background.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := h.store.Close(ctx); err != nil {
+		log.Printf("Error closing database connection: %v", err)
+	}
+}
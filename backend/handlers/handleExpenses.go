@@ -6,62 +6,88 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"tacohut/middlewares"
 	"time"
-)
 
-type Expenses struct {
-	Amount string        `json:"amount" bson:"amount"`
-	Category string      `json:"category" bson:"category"`
-	Description string   `json:"description" bson:"description"`
-	PaymentMethod string `json:"paymentMethod" bson:"paymentMethod"`
-	TimeAdded time.Time  `json:"timeAdded" bson:"timeAdded"`
-}
+	"tacohut/models"
 
-func HandleExpense(w http.ResponseWriter, r *http.Request) {
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (h *Handler) HandleExpense(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var expenses Expenses
-    err := json.NewDecoder(r.Body).Decode(&expenses)
-    if err != nil {
-        http.Error(w, "Bad request: "+ err.Error(), http.StatusBadRequest)
-        return
-    }
-
-	expenses.TimeAdded = time.Now()
-
-	fmt.Println("Received:", expenses)
+	var expenses models.Expenses
+	err := json.NewDecoder(r.Body).Decode(&expenses)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if middlewares.MongoClient == nil {
-		log.Println("Database connection is nil!")
-		http.Error(w, "Database connection error", http.StatusInternalServerError)
+	if err := checkCurrency(expenses.Amount); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkRollupKey("category", expenses.Category); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	collectionExpenses := middlewares.ExpensesDB.Collection("dailyExpense")
+	expenses.TimeAdded = time.Now()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	insertResult, err := collectionExpenses.InsertOne(ctx, expenses)
+	var insertedID primitive.ObjectID
+	err = h.store.RunInTransaction(ctx, func(ctx context.Context) error {
+		id, err := h.store.Expenses().InsertExpense(ctx, expenses)
+		if err != nil {
+			return fmt.Errorf("error inserting expenses: %w", err)
+		}
+
+		if err := h.applyExpense(ctx, expenses, 1); err != nil {
+			return err
+		}
+
+		insertedID = id
+		return nil
+	})
 	if err != nil {
-		log.Printf("Error inserting sales into DB: %v", err)
+		log.Printf("Error recording expense: %v", err)
 		http.Error(w, "Internal server error: Could not save expenses data!", http.StatusInternalServerError)
 		return
 	}
 
-	fmt.Printf("Succesfully inserted expenses datawith id: %v\n", insertResult.InsertedID)
+	log.Printf("Inserted expense %s", insertedID.Hex())
+
+	h.detectAfterExpense(models.ExpensesFetched{
+		ID:            insertedID,
+		Amount:        expenses.Amount,
+		Category:      expenses.Category,
+		Description:   expenses.Description,
+		PaymentMethod: expenses.PaymentMethod,
+		TimeAdded:     expenses.TimeAdded,
+	})
 
 	response := map[string]interface{}{
-		"status": "success",
-		"message": "Sales data received and saved",
-		"salesId": insertResult.InsertedID,
+		"status":    "success",
+		"message":   "Expense received and saved",
+		"expenseId": insertedID,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
+}
 
-	expenses.CalculateDailyExpenses(w, r)
-}
\ No newline at end of file
+// applyExpense adds an expense to (sign 1) or takes it out of (sign -1)
+// every rollup, like applySale.
+func (h *Handler) applyExpense(ctx context.Context, expenses models.Expenses, sign int) error {
+	if err := h.incrementPeriods(ctx, expenses.TimeAdded, expenseDelta(expenses, sign)); err != nil {
+		return err
+	}
+	if err := h.store.Daily().IncrementDay(ctx, h.dayOf(expenses.TimeAdded), expenseDelta(expenses, sign)); err != nil {
+		return fmt.Errorf("error updating daily expenses: %w", err)
+	}
+	return nil
+}
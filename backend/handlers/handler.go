@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"sync"
+
+	"tacohut/store"
+)
+
+// Handler serves the HTTP API. All persistence goes through the injected
+// store so the same handlers run against Mongo or the in-memory backend.
+type Handler struct {
+	store    store.Store
+	calendar Calendar
+
+	// background tracks the anomaly checks that run after a write.
+	background sync.WaitGroup
+}
+
+func New(s store.Store, calendar Calendar) *Handler {
+	return &Handler{store: s, calendar: calendar}
+}
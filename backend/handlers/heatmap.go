@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"tacohut/models"
+	"tacohut/store"
+)
+
+// HeatmapCell is the sales of one weekday and hour across the range.
+type HeatmapCell struct {
+	Sales        models.Money `json:"sales"`
+	Transactions int          `json:"transactions"`
+	Items        int          `json:"items"`
+}
+
+// SalesHeatmap is a 7x24 matrix for staffing. Rows are weekdays from the
+// business week start and columns clock hours from the business day start,
+// so a shift reads left to right; Days and Hours label them.
+type SalesHeatmap struct {
+	From     time.Time       `json:"from"`
+	To       time.Time       `json:"to"`
+	Timezone string          `json:"timezone"`
+	Days     []string        `json:"days"`
+	Hours    []int           `json:"hours"`
+	Cells    [][]HeatmapCell `json:"cells"`
+}
+
+// GetSalesHeatmap serves GET /api/analytics/heatmap?from=...&to=...,
+// defaulting to the last four weeks.
+func (h *Handler) GetSalesHeatmap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := h.parseRecentRange(r)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	heatmap, err := h.SalesHeatmap(ctx, from, to)
+	if err != nil {
+		log.Printf("Error building sales heatmap: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeAnalytics(w, heatmap)
+}
+
+// SalesHeatmap totals the sales recorded in [from, to] by weekday and hour.
+func (h *Handler) SalesHeatmap(ctx context.Context, from, to time.Time) (SalesHeatmap, error) {
+	totals, err := h.store.Sales().SalesByHour(ctx, store.HourQuery{
+		From:         from,
+		To:           to,
+		Location:     h.calendar.Location,
+		DayStartHour: h.calendar.DayStartHour,
+	})
+	if err != nil {
+		return SalesHeatmap{}, err
+	}
+
+	heatmap := SalesHeatmap{
+		From:     from,
+		To:       to,
+		Timezone: h.calendar.Location.String(),
+		Days:     make([]string, 7),
+		Hours:    make([]int, 24),
+		Cells:    make([][]HeatmapCell, 7),
+	}
+	for row := range heatmap.Cells {
+		heatmap.Days[row] = ((h.calendar.WeekStart + time.Weekday(row)) % 7).String()
+		heatmap.Cells[row] = make([]HeatmapCell, 24)
+		for col := range heatmap.Cells[row] {
+			heatmap.Cells[row][col].Sales = models.NewMoney(0)
+		}
+	}
+	for col := range heatmap.Hours {
+		heatmap.Hours[col] = (h.calendar.DayStartHour + col) % 24
+	}
+
+	for _, total := range totals {
+		row := (int(total.Weekday) - int(h.calendar.WeekStart) + 7) % 7
+		col := (total.Hour - h.calendar.DayStartHour + 24) % 24
+		cell := &heatmap.Cells[row][col]
+		cell.Sales = cell.Sales.Add(models.NewMoney(total.Sales))
+		cell.Transactions += total.Transactions
+		cell.Items += total.Items
+	}
+	return heatmap, nil
+}
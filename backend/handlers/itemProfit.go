@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"tacohut/models"
+)
+
+// ItemProfit is one menu item's line in the profitability report.
+// MarginPercent is margin over revenue and MarginShare the item's part of
+// the total margin; both are omitted when their base is zero.
+type ItemProfit struct {
+	Rank          int          `json:"rank"`
+	MenuItemID    string       `json:"menuItemId"`
+	Name          string       `json:"name"`
+	Quantity      int          `json:"quantity"`
+	Revenue       models.Money `json:"revenue"`
+	Cost          models.Money `json:"cost"`
+	Margin        models.Money `json:"margin"`
+	MarginPercent *float64     `json:"marginPercent,omitempty"`
+	MarginShare   *float64     `json:"marginShare,omitempty"`
+}
+
+type ItemProfitReport struct {
+	Period        string       `json:"period"`
+	From          time.Time    `json:"from"`
+	To            time.Time    `json:"to"`
+	SortBy        string       `json:"sortBy"`
+	Items         []ItemProfit `json:"items"`
+	Revenue       models.Money `json:"revenue"`
+	Cost          models.Money `json:"cost"`
+	Margin        models.Money `json:"margin"`
+	MarginPercent *float64     `json:"marginPercent,omitempty"`
+}
+
+// Sort keys accepted by the item profitability report.
+var itemProfitSorts = []string{"margin", "marginPercent", "quantity", "revenue"}
+
+// GetItemProfit serves GET /api/analytics/items, ranking menu items by
+// contribution margin (default), marginPercent, quantity or revenue:
+//
+//	/api/analytics/items?period=monthly&date=2026-10-01&sort=marginPercent
+//	/api/analytics/items?period=weekly&from=...&to=...
+//
+// The figures come from the period rollups, so a range is rounded out to
+// whole periods.
+func (h *Handler) GetItemProfit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "daily"
+	}
+	if !h.calendar.Rollup(period) {
+		http.Error(w, "Invalid period. Use: "+strings.Join(h.calendar.PeriodNames(), ", "), http.StatusBadRequest)
+		return
+	}
+
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy == "" {
+		sortBy = "margin"
+	}
+	valid := false
+	for _, s := range itemProfitSorts {
+		valid = valid || s == sortBy
+	}
+	if !valid {
+		http.Error(w, "Invalid sort. Use: "+strings.Join(itemProfitSorts, ", "), http.StatusBadRequest)
+		return
+	}
+
+	descending, err := parseOrder(r)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := h.parseReportRange(r, period)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	report, err := h.ItemProfitBetween(ctx, period, from, to, sortBy, descending)
+	if errors.Is(err, errRangeTooLong) {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Error building item profitability report: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeAnalytics(w, report)
+}
+
+// ItemProfitBetween merges the per-item stats of the period rollups
+// overlapping [from, to] and ranks them.
+func (h *Handler) ItemProfitBetween(ctx context.Context, period string, from, to time.Time, sortBy string, descending bool) (ItemProfitReport, error) {
+	window, err := h.AnalyticsBetween(ctx, period, from, to)
+	if err != nil {
+		return ItemProfitReport{}, err
+	}
+	summary := window.Summary
+
+	report := ItemProfitReport{
+		Period:  period,
+		From:    summary.StartDate,
+		To:      summary.EndDate,
+		SortBy:  sortBy,
+		Items:   make([]ItemProfit, 0, len(summary.Items)),
+		Revenue: models.NewMoney(0),
+		Cost:    models.NewMoney(0),
+	}
+	for _, stats := range summary.Items {
+		report.Revenue = report.Revenue.Add(stats.Revenue)
+		report.Cost = report.Cost.Add(stats.Cost)
+	}
+	report.Margin = report.Revenue.Sub(report.Cost)
+	report.MarginPercent = ratioPercent(report.Margin.Cents, report.Revenue.Cents)
+
+	for key, stats := range summary.Items {
+		report.Items = append(report.Items, ItemProfit{
+			MenuItemID:    key,
+			Name:          stats.Name,
+			Quantity:      stats.Quantity,
+			Revenue:       stats.Revenue,
+			Cost:          stats.Cost,
+			Margin:        stats.Revenue.Sub(stats.Cost),
+			MarginPercent: ratioPercent(stats.Revenue.Sub(stats.Cost).Cents, stats.Revenue.Cents),
+			MarginShare:   ratioPercent(stats.Revenue.Sub(stats.Cost).Cents, report.Margin.Cents),
+		})
+	}
+
+	key := func(item ItemProfit) float64 {
+		switch sortBy {
+		case "marginPercent":
+			if item.MarginPercent == nil {
+				return 0
+			}
+			return *item.MarginPercent
+		case "quantity":
+			return float64(item.Quantity)
+		case "revenue":
+			return float64(item.Revenue.Cents)
+		}
+		return float64(item.Margin.Cents)
+	}
+	sort.Slice(report.Items, func(i, j int) bool {
+		a, b := key(report.Items[i]), key(report.Items[j])
+		if a != b {
+			return a > b == descending
+		}
+		return report.Items[i].MenuItemID < report.Items[j].MenuItemID
+	})
+	for i := range report.Items {
+		report.Items[i].Rank = i + 1
+	}
+
+	return report, nil
+}
+
+// ratioPercent is part over whole as a percentage rounded to two
+// decimals, or nil when whole is zero.
+func ratioPercent(part, whole int64) *float64 {
+	if whole == 0 {
+		return nil
+	}
+	p := math.Round(float64(part)/float64(whole)*10000) / 100
+	return &p
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tacohut/models"
+)
+
+// Menu engineering classes, from popularity (menu mix) against
+// profitability (contribution margin per unit).
+const (
+	ClassStar      = "star"      // popular and profitable: keep
+	ClassPlowhorse = "plowhorse" // popular, low margin: reprice or cut cost
+	ClassPuzzle    = "puzzle"    // profitable, rarely ordered: promote
+	ClassDog       = "dog"       // neither: consider dropping
+)
+
+var menuClassOrder = map[string]int{ClassStar: 0, ClassPlowhorse: 1, ClassPuzzle: 2, ClassDog: 3}
+
+// defaultPopularityFactor is the usual 70% rule: an item is popular when
+// its share of units sold reaches 70% of an equal share.
+const defaultPopularityFactor = 0.7
+
+// MenuEngineeringItem is one item placed on the matrix. MenuMix is its
+// percentage of all units sold.
+type MenuEngineeringItem struct {
+	MenuItemID string       `json:"menuItemId"`
+	Name       string       `json:"name"`
+	Quantity   int          `json:"quantity"`
+	MenuMix    float64      `json:"menuMix"`
+	Revenue    models.Money `json:"revenue"`
+	Margin     models.Money `json:"margin"`
+	UnitMargin models.Money `json:"unitMargin"`
+	Class      string       `json:"class"`
+}
+
+// MenuThresholds are the cut-offs the classification used. An item is
+// popular when MenuMix >= PopularityPercent and profitable when its
+// UnitMargin >= UnitMargin, the average over every unit sold.
+type MenuThresholds struct {
+	PopularityFactor  float64      `json:"popularityFactor"`
+	PopularityPercent float64      `json:"popularityPercent"`
+	UnitMargin        models.Money `json:"unitMargin"`
+}
+
+type MenuEngineeringReport struct {
+	Period     string                `json:"period"`
+	From       time.Time             `json:"from"`
+	To         time.Time             `json:"to"`
+	Thresholds MenuThresholds        `json:"thresholds"`
+	Classes    map[string]int        `json:"classes"`
+	Items      []MenuEngineeringItem `json:"items"`
+}
+
+// GetMenuEngineering serves GET /api/analytics/menu-engineering, taking
+// period with date or from/to like the item profitability report, and an
+// optional popularityFactor (default 0.7).
+func (h *Handler) GetMenuEngineering(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "daily"
+	}
+	if !h.calendar.Rollup(period) {
+		http.Error(w, "Invalid period. Use: "+strings.Join(h.calendar.PeriodNames(), ", "), http.StatusBadRequest)
+		return
+	}
+
+	factor := defaultPopularityFactor
+	if value := r.URL.Query().Get("popularityFactor"); value != "" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f <= 0 || f > 1 {
+			http.Error(w, "Bad request: popularityFactor must be above 0 and at most 1", http.StatusBadRequest)
+			return
+		}
+		factor = f
+	}
+
+	from, to, err := h.parseReportRange(r, period)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	report, err := h.MenuEngineering(ctx, period, from, to, factor)
+	if errors.Is(err, errRangeTooLong) {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Error building menu engineering report: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeAnalytics(w, report)
+}
+
+// MenuEngineering classifies every item sold in the period rollups
+// overlapping [from, to]. Items with no net units sold, e.g. after voids,
+// are left out.
+func (h *Handler) MenuEngineering(ctx context.Context, period string, from, to time.Time, factor float64) (MenuEngineeringReport, error) {
+	window, err := h.AnalyticsBetween(ctx, period, from, to)
+	if err != nil {
+		return MenuEngineeringReport{}, err
+	}
+	summary := window.Summary
+
+	report := MenuEngineeringReport{
+		Period:  period,
+		From:    summary.StartDate,
+		To:      summary.EndDate,
+		Classes: map[string]int{ClassStar: 0, ClassPlowhorse: 0, ClassPuzzle: 0, ClassDog: 0},
+		Items:   []MenuEngineeringItem{},
+	}
+
+	var units int
+	margin := models.NewMoney(0)
+	for _, stats := range summary.Items {
+		if stats.Quantity > 0 {
+			units += stats.Quantity
+			margin = margin.Add(stats.Revenue.Sub(stats.Cost))
+		}
+	}
+	if units == 0 {
+		report.Thresholds = MenuThresholds{PopularityFactor: factor, UnitMargin: models.NewMoney(0)}
+		return report, nil
+	}
+
+	sold := 0
+	for _, stats := range summary.Items {
+		if stats.Quantity > 0 {
+			sold++
+		}
+	}
+	report.Thresholds = MenuThresholds{
+		PopularityFactor:  factor,
+		PopularityPercent: roundPercent(factor * 100 / float64(sold)),
+		UnitMargin:        unitMoney(margin, units),
+	}
+
+	for key, stats := range summary.Items {
+		if stats.Quantity <= 0 {
+			continue
+		}
+		item := MenuEngineeringItem{
+			MenuItemID: key,
+			Name:       stats.Name,
+			Quantity:   stats.Quantity,
+			MenuMix:    roundPercent(float64(stats.Quantity) * 100 / float64(units)),
+			Revenue:    stats.Revenue,
+			Margin:     stats.Revenue.Sub(stats.Cost),
+		}
+		item.UnitMargin = unitMoney(item.Margin, item.Quantity)
+
+		// Compare unrounded shares so the rounding shown cannot move an
+		// item across a threshold.
+		popular := float64(stats.Quantity)*float64(sold) >= factor*float64(units)
+		profitable := item.Margin.Cents*int64(units) >= margin.Cents*int64(item.Quantity)
+		switch {
+		case popular && profitable:
+			item.Class = ClassStar
+		case popular:
+			item.Class = ClassPlowhorse
+		case profitable:
+			item.Class = ClassPuzzle
+		default:
+			item.Class = ClassDog
+		}
+		report.Classes[item.Class]++
+		report.Items = append(report.Items, item)
+	}
+
+	sort.Slice(report.Items, func(i, j int) bool {
+		a, b := report.Items[i], report.Items[j]
+		if a.Class != b.Class {
+			return menuClassOrder[a.Class] < menuClassOrder[b.Class]
+		}
+		if a.Margin.Cents != b.Margin.Cents {
+			return a.Margin.Cents > b.Margin.Cents
+		}
+		return a.MenuItemID < b.MenuItemID
+	})
+
+	return report, nil
+}
+
+// unitMoney divides an amount over n units, rounding to the nearest cent.
+func unitMoney(total models.Money, n int) models.Money {
+	return models.NewMoney(int64(math.Round(float64(total.Cents) / float64(n))))
+}
+
+func roundPercent(p float64) float64 {
+	return math.Round(p*100) / 100
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tacohut/models"
+	"tacohut/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 500
+)
+
+// cursorToken is the decoded form of the opaque "next" token. It records
+// the listing order it was issued for so a token cannot be replayed against
+// a different sort.
+type cursorToken struct {
+	Sort       string    `json:"s"`
+	Descending bool      `json:"d"`
+	Time       time.Time `json:"t,omitempty"`
+	Cents      int64     `json:"c,omitempty"`
+	ID         string    `json:"id"`
+}
+
+func encodeCursor(c *store.PageCursor, sortBy string, descending bool) string {
+	if c == nil {
+		return ""
+	}
+	data, _ := json.Marshal(cursorToken{
+		Sort:       sortBy,
+		Descending: descending,
+		Time:       c.Time,
+		Cents:      c.Cents,
+		ID:         c.ID.Hex(),
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token, sortBy string, descending bool) (*store.PageCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var t cursorToken
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if t.Sort != sortBy || t.Descending != descending {
+		return nil, fmt.Errorf("cursor was issued for a different sort order")
+	}
+	id, err := primitive.ObjectIDFromHex(t.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &store.PageCursor{Time: t.Time, Cents: t.Cents, ID: id}, nil
+}
+
+// parseLimit reads the page size, defaulting to defaultPageSize.
+func parseLimit(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+	return limit, nil
+}
+
+// parseListLimit is parseLimit for the sales and expenses listings, which
+// older pages read in one request: without limit or cursor it returns 0,
+// meaning every matching row.
+func parseListLimit(r *http.Request) (int, error) {
+	params := r.URL.Query()
+	if !params.Has("limit") && !params.Has("cursor") {
+		return 0, nil
+	}
+	return parseLimit(r)
+}
+
+// parseOrder reads the "order" parameter: "desc" (the default) or "asc".
+func parseOrder(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("order") {
+	case "", "desc":
+		return true, nil
+	case "asc":
+		return false, nil
+	default:
+		return false, fmt.Errorf("order must be asc or desc")
+	}
+}
+
+// parseTimeParam reads a query parameter as either a YYYY-MM-DD business
+// day or an RFC 3339 timestamp. A bare day used as an upper bound covers
+// the whole day. Missing parameters give the zero time.
+func (h *Handler) parseTimeParam(r *http.Request, name string, endOfDay bool) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := h.calendar.ParseDay(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s, use YYYY-MM-DD or RFC 3339", name)
+	}
+	if endOfDay {
+		_, t = h.calculateDateRange(t, "daily")
+	}
+	return t, nil
+}
+
+// parseMoneyParam reads an amount in major units as cents, or nil if the
+// parameter is missing.
+func parseMoneyParam(r *http.Request, name string) (*int64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := models.ParseMoney(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return &amount.Cents, nil
+}
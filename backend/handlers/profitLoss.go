@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"tacohut/models"
+)
+
+// uncategorized labels sale items recorded without a menu category.
+const uncategorized = "uncategorized"
+
+// PnLLine is one line of a statement section. Percent is the line's share
+// of revenue.
+type PnLLine struct {
+	Name    string       `json:"name"`
+	Amount  models.Money `json:"amount"`
+	Percent *float64     `json:"percent,omitempty"`
+}
+
+type PnLSection struct {
+	Lines []PnLLine    `json:"lines"`
+	Total models.Money `json:"total"`
+}
+
+// ProfitAndLoss is the income statement for a date range, built from the
+// raw sales and expenses rather than the rollups.
+//
+// Revenue is what was taken per payment method. RevenueByCategory splits
+// the same total by menu category from the line items; when sale totals
+// differ from their lines, e.g. after a discount, the difference is an
+// "adjustments" line so both views add up.
+type ProfitAndLoss struct {
+	From              time.Time  `json:"from"`
+	To                time.Time  `json:"to"`
+	Currency          string     `json:"currency"`
+	Transactions      int        `json:"transactions"`
+	Revenue           PnLSection `json:"revenue"`
+	RevenueByCategory PnLSection `json:"revenueByCategory"`
+	CostOfGoods       PnLSection `json:"costOfGoods"`
+	GrossProfit       PnLLine    `json:"grossProfit"`
+	OperatingExpenses PnLSection `json:"operatingExpenses"`
+	NetProfit         PnLLine    `json:"netProfit"`
+}
+
+// GetProfitAndLoss serves GET /api/reports/pnl. The range is from/to, or
+// the period (default monthly) containing date. format picks json
+// (default), csv or html, the last meant for printing.
+func (h *Handler) GetProfitAndLoss(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "monthly"
+	}
+	if _, ok := h.calendar.Period(period); !ok {
+		http.Error(w, "Invalid period", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "csv", "html":
+	default:
+		http.Error(w, "Invalid format. Use: json, csv, html", http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := h.parseReportRange(r, period)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pnl, err := h.ProfitAndLoss(ctx, from, to)
+	if err != nil {
+		log.Printf("Error building profit and loss: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch format {
+	case "csv":
+		filename := fmt.Sprintf("pnl-%s-%s.csv", from.Format("2006-01-02"), to.Format("2006-01-02"))
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		if err := writePnLCSV(w, pnl); err != nil {
+			log.Printf("Error writing profit and loss CSV: %v", err)
+		}
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := pnlTemplate.Execute(w, pnl); err != nil {
+			log.Printf("Error rendering profit and loss: %v", err)
+		}
+	default:
+		writeAnalytics(w, pnl)
+	}
+}
+
+// ProfitAndLoss builds the statement for sales and expenses in [from, to].
+func (h *Handler) ProfitAndLoss(ctx context.Context, from, to time.Time) (ProfitAndLoss, error) {
+	sales, err := h.store.Sales().SalesBetween(ctx, from, to)
+	if err != nil {
+		return ProfitAndLoss{}, fmt.Errorf("error reading sales: %w", err)
+	}
+	expenses, err := h.store.Expenses().ExpensesBetween(ctx, from, to)
+	if err != nil {
+		return ProfitAndLoss{}, fmt.Errorf("error reading expenses: %w", err)
+	}
+
+	byMethod := make(map[string]models.Money)
+	byCategory := make(map[string]models.Money)
+	costByCategory := make(map[string]models.Money)
+	byExpense := make(map[string]models.Money)
+
+	for _, sale := range sales {
+		byMethod[sale.PaymentMethod] = byMethod[sale.PaymentMethod].Add(sale.Total)
+
+		lines := models.NewMoney(0)
+		for _, item := range sale.Items {
+			category := item.Category
+			if category == "" {
+				category = uncategorized
+			}
+			revenue := item.Price.Mul(item.Quantity)
+			byCategory[category] = byCategory[category].Add(revenue)
+			costByCategory[category] = costByCategory[category].Add(item.Cost.Mul(item.Quantity))
+			lines = lines.Add(revenue)
+		}
+		if adjustment := sale.Total.Sub(lines); !adjustment.IsZero() {
+			byCategory["adjustments"] = byCategory["adjustments"].Add(adjustment)
+		}
+	}
+	for _, expense := range expenses {
+		byExpense[expense.Category] = byExpense[expense.Category].Add(expense.Amount)
+	}
+
+	pnl := ProfitAndLoss{
+		From:         from,
+		To:           to,
+		Currency:     models.Currency,
+		Transactions: len(sales),
+	}
+	revenue := models.NewMoney(0)
+	for _, amount := range byMethod {
+		revenue = revenue.Add(amount)
+	}
+	pnl.Revenue = pnlSection(byMethod, revenue)
+	pnl.RevenueByCategory = pnlSection(byCategory, revenue)
+	pnl.CostOfGoods = pnlSection(costByCategory, revenue)
+	pnl.OperatingExpenses = pnlSection(byExpense, revenue)
+
+	gross := revenue.Sub(pnl.CostOfGoods.Total)
+	pnl.GrossProfit = PnLLine{Name: "Gross profit", Amount: gross, Percent: ratioPercent(gross.Cents, revenue.Cents)}
+	net := gross.Sub(pnl.OperatingExpenses.Total)
+	pnl.NetProfit = PnLLine{Name: "Net profit", Amount: net, Percent: ratioPercent(net.Cents, revenue.Cents)}
+	return pnl, nil
+}
+
+// pnlSection lists amounts largest first with their share of revenue.
+func pnlSection(amounts map[string]models.Money, revenue models.Money) PnLSection {
+	section := PnLSection{Lines: []PnLLine{}, Total: models.NewMoney(0)}
+	for name, amount := range amounts {
+		section.Lines = append(section.Lines, PnLLine{Name: name, Amount: amount, Percent: ratioPercent(amount.Cents, revenue.Cents)})
+		section.Total = section.Total.Add(amount)
+	}
+	sort.Slice(section.Lines, func(i, j int) bool {
+		a, b := section.Lines[i], section.Lines[j]
+		if a.Amount.Cents != b.Amount.Cents {
+			return a.Amount.Cents > b.Amount.Cents
+		}
+		return a.Name < b.Name
+	})
+	return section
+}
+
+// writePnLCSV writes one row per line with its section, so the file sorts
+// and pivots cleanly in a spreadsheet. Amounts are in major units.
+func writePnLCSV(w http.ResponseWriter, pnl ProfitAndLoss) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"section", "line", "amount", "percentOfRevenue"})
+
+	row := func(section string, line PnLLine) {
+		percent := ""
+		if line.Percent != nil {
+			percent = fmt.Sprintf("%.2f", *line.Percent)
+		}
+		out.Write([]string{section, line.Name, line.Amount.Major(), percent})
+	}
+	sectionRows := func(name string, section PnLSection) {
+		for _, line := range section.Lines {
+			row(name, line)
+		}
+		row(name, PnLLine{Name: "Total", Amount: section.Total})
+	}
+
+	sectionRows("Revenue", pnl.Revenue)
+	sectionRows("Revenue by category", pnl.RevenueByCategory)
+	sectionRows("Cost of goods", pnl.CostOfGoods)
+	row("Gross profit", pnl.GrossProfit)
+	sectionRows("Operating expenses", pnl.OperatingExpenses)
+	row("Net profit", pnl.NetProfit)
+
+	out.Flush()
+	return out.Error()
+}
+
+var pnlTemplate = template.Must(template.New("pnl").Funcs(template.FuncMap{
+	"day": func(t time.Time) string { return t.Format("2 Jan 2006") },
+	"percent": func(p *float64) string {
+		if p == nil {
+			return ""
+		}
+		return fmt.Sprintf("%.1f%%", *p)
+	},
+	"section": func(title string, section PnLSection) any {
+		return struct {
+			Title   string
+			Section PnLSection
+		}{title, section}
+	},
+	"title": func(s string) string {
+		r, size := utf8.DecodeRuneInString(s)
+		if r == utf8.RuneError {
+			return s
+		}
+		return string(unicode.ToUpper(r)) + s[size:]
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Profit and loss {{day .From}} to {{day .To}}</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; color: #222; }
+h1 { font-size: 1.4em; margin-bottom: 0; }
+p.range { margin-top: .2em; color: #555; }
+table { width: 100%; border-collapse: collapse; margin-bottom: 1.5em; }
+th { text-align: left; border-bottom: 2px solid #222; padding: .3em 0; }
+td { padding: .2em 0; }
+td.amount, td.percent { text-align: right; width: 8em; }
+tr.total td { border-top: 1px solid #222; font-weight: bold; }
+tr.result td { border-top: 2px solid #222; border-bottom: 2px solid #222; font-weight: bold; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>Profit and loss</h1>
+<p class="range">{{day .From}} to {{day .To}}, {{.Transactions}} sales, amounts in {{.Currency}}</p>
+{{define "section"}}
+<table>
+<tr><th>{{.Title}}</th><th></th><th></th></tr>
+{{range .Section.Lines}}<tr><td>{{title .Name}}</td><td class="amount">{{.Amount.Major}}</td><td class="percent">{{percent .Percent}}</td></tr>
+{{end}}<tr class="total"><td>Total</td><td class="amount">{{.Section.Total.Major}}</td><td></td></tr>
+</table>
+{{end}}
+{{template "section" (section "Revenue" .Revenue)}}
+{{template "section" (section "Revenue by menu category" .RevenueByCategory)}}
+{{template "section" (section "Cost of goods" .CostOfGoods)}}
+<table><tr class="result"><td>{{.GrossProfit.Name}}</td><td class="amount">{{.GrossProfit.Amount.Major}}</td><td class="percent">{{percent .GrossProfit.Percent}}</td></tr></table>
+{{template "section" (section "Operating expenses" .OperatingExpenses)}}
+<table><tr class="result"><td>{{.NetProfit.Name}}</td><td class="amount">{{.NetProfit.Amount.Major}}</td><td class="percent">{{percent .NetProfit.Percent}}</td></tr></table>
+</body>
+</html>
+`))
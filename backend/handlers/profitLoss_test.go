@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPnLTemplateTitle(t *testing.T) {
+	tmpl, err := pnlTemplate.Clone()
+	if err != nil {
+		t.Fatalf("Clone: %v", err)
+	}
+	tmpl, err = tmpl.New("title").Parse(`{{title .}}`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	tests := map[string]string{
+		"":         "",
+		"rent":     "Rent",
+		"école":    "École",
+		"ñame":     "Ñame",
+		"M-Pesa":   "M-Pesa",
+		"1st shop": "1st shop",
+	}
+	for in, want := range tests {
+		var out strings.Builder
+		if err := tmpl.Execute(&out, in); err != nil {
+			t.Fatalf("title %q: %v", in, err)
+		}
+		if out.String() != want {
+			t.Errorf("title %q = %q, want %q", in, out.String(), want)
+		}
+	}
+}
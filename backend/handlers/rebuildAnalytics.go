@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"tacohut/models"
+	"tacohut/store"
+)
+
+// ValueDrift is one rollup field whose stored value differs from the value
+// recomputed from raw sales and expenses. Money fields are in cents.
+type ValueDrift struct {
+	Stored   int64 `json:"stored"`
+	Expected int64 `json:"expected"`
+}
+
+// RollupDrift lists the drifting fields of one rollup document. Field names
+// follow the stored document, e.g. "totalSales" or "itemsSold.Taco".
+type RollupDrift struct {
+	Period    string                `json:"period"` // "dailyAnalysis" or a rollup period, e.g. "weekly"
+	StartDate time.Time             `json:"startDate"`
+	EndDate   time.Time             `json:"endDate"`
+	Missing   bool                  `json:"missing,omitempty"`
+	Fields    map[string]ValueDrift `json:"fields"`
+}
+
+type RebuildReport struct {
+	From           time.Time     `json:"from"`
+	To             time.Time     `json:"to"`
+	DryRun         bool          `json:"dryRun"`
+	RollupsChecked int           `json:"rollupsChecked"`
+	Drift          []RollupDrift `json:"drift"`
+}
+
+// RebuildAnalytics recomputes every rollup touching [from, to] from the raw
+// sales and expenses. Rollups longer than a day are rebuilt whole, so the
+// raw data read may start before from and end after to. With dryRun
+// set nothing is written and the report only describes the drift.
+//
+// Each rollup is rebuilt in a transaction of its own together with the raw
+// data it is computed from. That keeps every transaction well inside
+// Mongo's 60 second limit however long the range, and a rebuild that fails
+// part way leaves each rollup either as it was or fully rebuilt.
+func (h *Handler) RebuildAnalytics(ctx context.Context, from, to time.Time, dryRun bool) (RebuildReport, error) {
+	report := RebuildReport{From: from, To: to, DryRun: dryRun, Drift: []RollupDrift{}}
+
+	// record runs one rollup's rebuild in its own transaction and adds the
+	// outcome to the report once it has committed. A dry run writes
+	// nothing, so it needs no transaction.
+	record := func(rebuild func(ctx context.Context) (*RollupDrift, bool, error)) error {
+		var drift *RollupDrift
+		var checked bool
+		run := func(ctx context.Context) error {
+			var err error
+			drift, checked, err = rebuild(ctx)
+			return err
+		}
+		var err error
+		if dryRun {
+			err = run(ctx)
+		} else {
+			err = h.store.RunInTransaction(ctx, run)
+		}
+		if err != nil {
+			return err
+		}
+		if checked {
+			report.RollupsChecked++
+		}
+		if drift != nil {
+			report.Drift = append(report.Drift, *drift)
+		}
+		return nil
+	}
+
+	for _, period := range h.calendar.PeriodNames() {
+		for startDate, endDate := h.calculateDateRange(from, period); !startDate.After(to); startDate, endDate = h.calculateDateRange(endDate.Add(time.Nanosecond), period) {
+			err := record(func(ctx context.Context) (*RollupDrift, bool, error) {
+				return h.rebuildPeriod(ctx, period, startDate, endDate, dryRun)
+			})
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+
+	for date, dayEnd := h.calculateDateRange(from, "daily"); !date.After(to); date, dayEnd = h.calculateDateRange(dayEnd.Add(time.Nanosecond), "daily") {
+		err := record(func(ctx context.Context) (*RollupDrift, bool, error) {
+			return h.rebuildDay(ctx, date, dayEnd, dryRun)
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	sort.Slice(report.Drift, func(i, j int) bool {
+		if !report.Drift[i].StartDate.Equal(report.Drift[j].StartDate) {
+			return report.Drift[i].StartDate.Before(report.Drift[j].StartDate)
+		}
+		return report.Drift[i].Period < report.Drift[j].Period
+	})
+	return report, nil
+}
+
+// rawBetween reads the sales and expenses recorded in [from, to].
+func (h *Handler) rawBetween(ctx context.Context, from, to time.Time) ([]models.SalesData, []models.ExpensesFetched, error) {
+	sales, err := h.store.Sales().SalesBetween(ctx, from, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading sales: %w", err)
+	}
+	expenses, err := h.store.Expenses().ExpensesBetween(ctx, from, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading expenses: %w", err)
+	}
+	return sales, expenses, nil
+}
+
+// rebuildPeriod checks, and unless dryRun rewrites, the period rollup for
+// [startDate, endDate]. It reports whether there was a rollup to check and
+// its drift, if any.
+func (h *Handler) rebuildPeriod(ctx context.Context, period string, startDate, endDate time.Time, dryRun bool) (*RollupDrift, bool, error) {
+	sales, expenses, err := h.rawBetween(ctx, startDate, endDate)
+	if err != nil {
+		return nil, false, err
+	}
+
+	expected := models.AnalyticsDelta{}
+	for _, sale := range sales {
+		addDelta(&expected, salePeriodDelta(sale, 1))
+	}
+	for _, expense := range expenses {
+		addDelta(&expected, expenseDelta(expenseOf(expense), 1))
+	}
+	hasData := len(sales) > 0 || len(expenses) > 0
+
+	stored, err := h.store.Periods().FindPeriod(ctx, period, startDate, endDate)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, false, fmt.Errorf("error reading %s analytics: %w", period, err)
+	}
+	found := err == nil
+	if !found && !hasData {
+		return nil, false, nil
+	}
+
+	var drift *RollupDrift
+	storedDelta := models.AnalyticsDelta{
+		ItemsSold:         stored.ItemsSold,
+		Items:             itemDeltas(stored.Items),
+		PaymentMethods:    moneyCents(stored.PaymentMethods),
+		ExpenseCategories: moneyCents(stored.ExpenseCategories),
+		TotalSales:        stored.TotalSales.Cents,
+		TotalExpenses:     stored.TotalExpenses.Cents,
+		CostOfGoods:       stored.CostOfGoods.Cents,
+		TransactionCount:  stored.TransactionCount,
+	}
+	fields := compareRollup(storedDelta, stored.NetProfit.Cents, expected, "paymentMethods", "expenseCategories")
+	if s, e := stored.OperatingExpenses.Cents, expected.TotalExpenses-expected.CostOfGoods; s != e {
+		fields["operatingExpenses"] = ValueDrift{Stored: s, Expected: e}
+	}
+	if s, e := stored.GrossProfit.Cents, expected.TotalSales-expected.CostOfGoods; s != e {
+		fields["grossProfit"] = ValueDrift{Stored: s, Expected: e}
+	}
+	if len(fields) > 0 || !found {
+		drift = &RollupDrift{
+			Period:    period,
+			StartDate: startDate,
+			EndDate:   endDate,
+			Missing:   !found,
+			Fields:    fields,
+		}
+	}
+
+	if dryRun {
+		return drift, true, nil
+	}
+
+	if found {
+		if err := h.store.Periods().DeletePeriod(ctx, period, startDate, endDate); err != nil {
+			return nil, false, fmt.Errorf("error clearing %s analytics: %w", period, err)
+		}
+	}
+	if hasData {
+		if err := h.store.Periods().IncrementPeriod(ctx, period, startDate, endDate, expected); err != nil {
+			return nil, false, fmt.Errorf("error rebuilding %s analytics: %w", period, err)
+		}
+	}
+	return drift, true, nil
+}
+
+// rebuildDay is rebuildPeriod for the dailyAnalysis document of the
+// business day [date, dayEnd].
+func (h *Handler) rebuildDay(ctx context.Context, date, dayEnd time.Time, dryRun bool) (*RollupDrift, bool, error) {
+	sales, expenses, err := h.rawBetween(ctx, date, dayEnd)
+	if err != nil {
+		return nil, false, err
+	}
+
+	expected := models.AnalyticsDelta{}
+	for _, sale := range sales {
+		addDelta(&expected, saleDailyDelta(sale, 1))
+	}
+	for _, expense := range expenses {
+		addDelta(&expected, expenseDelta(expenseOf(expense), 1))
+	}
+	hasData := len(sales) > 0 || len(expenses) > 0
+
+	stored, err := h.store.Daily().FindDay(ctx, date)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, false, fmt.Errorf("error reading daily analysis: %w", err)
+	}
+	found := err == nil
+	if !found && !hasData {
+		return nil, false, nil
+	}
+
+	var drift *RollupDrift
+	storedDelta := models.AnalyticsDelta{
+		ItemsSold:         stored.ItemsSold,
+		PaymentMethods:    addCounts[int64](nil, stored.PaymentSummary),
+		ExpenseCategories: moneyCents(stored.ExpenseCategory),
+		TotalSales:        stored.TotalSales.Cents,
+		TotalExpenses:     stored.TotalExpenses.Cents,
+	}
+	fields := compareRollup(storedDelta, stored.NetProfit.Cents, expected, "paymentSummary", "expenseCategory")
+	if len(fields) > 0 || !found {
+		drift = &RollupDrift{
+			Period:    "dailyAnalysis",
+			StartDate: date,
+			EndDate:   dayEnd,
+			Missing:   !found,
+			Fields:    fields,
+		}
+	}
+
+	if dryRun {
+		return drift, true, nil
+	}
+
+	if found {
+		if err := h.store.Daily().DeleteDayByDate(ctx, date); err != nil {
+			return nil, false, fmt.Errorf("error clearing daily analysis: %w", err)
+		}
+	}
+	if hasData {
+		if err := h.store.Daily().IncrementDay(ctx, date, expected); err != nil {
+			return nil, false, fmt.Errorf("error rebuilding daily analysis: %w", err)
+		}
+	}
+	return drift, true, nil
+}
+
+// addDelta accumulates d into total.
+func addDelta(total *models.AnalyticsDelta, d models.AnalyticsDelta) {
+	total.ItemsSold = addCounts(total.ItemsSold, d.ItemsSold)
+	total.Items = addItemDeltas(total.Items, d.Items)
+	total.PaymentMethods = addCounts(total.PaymentMethods, d.PaymentMethods)
+	total.ExpenseCategories = addCounts(total.ExpenseCategories, d.ExpenseCategories)
+	total.TotalSales += d.TotalSales
+	total.TotalExpenses += d.TotalExpenses
+	total.CostOfGoods += d.CostOfGoods
+	total.TransactionCount += d.TransactionCount
+}
+
+func addCounts[D, S int | int64](dst map[string]D, src map[string]S) map[string]D {
+	if dst == nil {
+		dst = make(map[string]D)
+	}
+	for key, value := range src {
+		dst[key] += D(value)
+	}
+	return dst
+}
+
+func addItemDeltas(dst, src map[string]models.ItemDelta) map[string]models.ItemDelta {
+	if dst == nil {
+		dst = make(map[string]models.ItemDelta)
+	}
+	for key, d := range src {
+		total := dst[key]
+		if d.Name != "" {
+			total.Name = d.Name
+		}
+		total.Quantity += d.Quantity
+		total.Revenue += d.Revenue
+		total.Cost += d.Cost
+		dst[key] = total
+	}
+	return dst
+}
+
+// itemDeltas flattens stored per-item stats to cents.
+func itemDeltas(items map[string]models.ItemStats) map[string]models.ItemDelta {
+	deltas := make(map[string]models.ItemDelta, len(items))
+	for key, stats := range items {
+		deltas[key] = models.ItemDelta{
+			Name:     stats.Name,
+			Quantity: stats.Quantity,
+			Revenue:  stats.Revenue.Cents,
+			Cost:     stats.Cost.Cents,
+		}
+	}
+	return deltas
+}
+
+// moneyCents flattens a map of Money totals to cents.
+func moneyCents(amounts map[string]models.Money) map[string]int64 {
+	cents := make(map[string]int64, len(amounts))
+	for key, value := range amounts {
+		cents[key] = value.Cents
+	}
+	return cents
+}
+
+// compareRollup returns the fields where stored and expected disagree.
+// paymentField and categoryField are the stored names of the payment and
+// expense category maps, which differ between period rollups and
+// dailyAnalysis.
+func compareRollup(stored models.AnalyticsDelta, storedNetProfit int64, expected models.AnalyticsDelta, paymentField, categoryField string) map[string]ValueDrift {
+	fields := make(map[string]ValueDrift)
+
+	compare := func(name string, s, e int64) {
+		if s != e {
+			fields[name] = ValueDrift{Stored: s, Expected: e}
+		}
+	}
+	compareCounts := func(prefix string, s, e map[string]int64) {
+		keys := make(map[string]bool)
+		for k := range s {
+			keys[k] = true
+		}
+		for k := range e {
+			keys[k] = true
+		}
+		for k := range keys {
+			compare(prefix+"."+k, s[k], e[k])
+		}
+	}
+
+	compare("totalSales", stored.TotalSales, expected.TotalSales)
+	compare("totalExpenses", stored.TotalExpenses, expected.TotalExpenses)
+	compare("costOfGoods", stored.CostOfGoods, expected.CostOfGoods)
+	compare("netProfit", storedNetProfit, expected.TotalSales-expected.TotalExpenses)
+	compare("transactionCount", int64(stored.TransactionCount), int64(expected.TransactionCount))
+	compareCounts("itemsSold", addCounts[int64](nil, stored.ItemsSold), addCounts[int64](nil, expected.ItemsSold))
+	compareCounts(paymentField, stored.PaymentMethods, expected.PaymentMethods)
+	compareCounts(categoryField, stored.ExpenseCategories, expected.ExpenseCategories)
+
+	items := make(map[string]bool)
+	for k := range stored.Items {
+		items[k] = true
+	}
+	for k := range expected.Items {
+		items[k] = true
+	}
+	for k := range items {
+		s, e := stored.Items[k], expected.Items[k]
+		compare("items."+k+".quantity", int64(s.Quantity), int64(e.Quantity))
+		compare("items."+k+".revenue", s.Revenue, e.Revenue)
+		compare("items."+k+".cost", s.Cost, e.Cost)
+	}
+
+	return fields
+}
+
+// parseDateRange reads the from/to query parameters as whole business
+// days, to inclusive.
+func (h *Handler) parseDateRange(r *http.Request) (time.Time, time.Time, error) {
+	from, err := h.calendar.ParseDay(r.URL.Query().Get("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from date, use YYYY-MM-DD")
+	}
+	to, err := h.calendar.ParseDay(r.URL.Query().Get("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to date, use YYYY-MM-DD")
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("to must not be before from")
+	}
+	_, toEnd := h.calculateDateRange(to, "daily")
+	return from, toEnd, nil
+}
+
+// RebuildAnalyticsHandler serves POST /api/admin/analytics/rebuild, which
+// rewrites the rollups, and GET /api/admin/analytics/verify, which only
+// reports drift.
+func (h *Handler) RebuildAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Path == "/api/admin/analytics/verify"
+	if (dryRun && r.Method != "GET") || (!dryRun && r.Method != "POST") {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := h.parseDateRange(r)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	report, err := h.RebuildAnalytics(ctx, from, to, dryRun)
+	if err != nil {
+		log.Printf("Error rebuilding analytics: %v", err)
+		http.Error(w, "Internal server error: Could not rebuild analytics", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"status": "success",
+		"data":   report,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tacohut/models"
+)
+
+func TestRebuildAnalytics(t *testing.T) {
+	ctx := context.Background()
+	server, h := newTestServer(t)
+
+	for _, at := range []string{"2024-03-04T12:00:00Z", "2024-03-05T12:00:00Z", "2024-03-12T12:00:00Z"} {
+		postSale(t, server, `{
+			"items": [{"menuItemId": "al-pastor", "name": "Al Pastor", "quantity": 2, "price": 4.5, "cost": 1.25}],
+			"paymentMethod": "cash",
+			"total": 9,
+			"recordedAt": "`+at+`"
+		}`)
+	}
+	h.background.Wait()
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC).Add(24*time.Hour - time.Nanosecond)
+
+	report, err := h.RebuildAnalytics(ctx, from, to, true)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(report.Drift) != 0 {
+		t.Fatalf("verify after posting found drift: %+v", report.Drift)
+	}
+	// 3 days, 2 weeks, 1 month, 1 year and 3 dailyAnalysis documents.
+	if report.RollupsChecked != 10 {
+		t.Errorf("RollupsChecked = %d, want 10", report.RollupsChecked)
+	}
+
+	weekStart, weekEnd := h.calculateDateRange(from.AddDate(0, 0, 3), "weekly")
+	if err := h.store.Periods().IncrementPeriod(ctx, "weekly", weekStart, weekEnd, models.AnalyticsDelta{TotalSales: 500}); err != nil {
+		t.Fatalf("IncrementPeriod: %v", err)
+	}
+
+	report, err = h.RebuildAnalytics(ctx, from, to, true)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(report.Drift) != 1 || report.Drift[0].Period != "weekly" || report.Drift[0].Fields["totalSales"] != (ValueDrift{Stored: 2300, Expected: 1800}) {
+		t.Fatalf("verify drift = %+v, want weekly totalSales 2300 against 1800", report.Drift)
+	}
+
+	if _, err := h.RebuildAnalytics(ctx, from, to, false); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	report, err = h.RebuildAnalytics(ctx, from, to, true)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(report.Drift) != 0 {
+		t.Errorf("verify after rebuild found drift: %+v", report.Drift)
+	}
+	week, err := h.store.Periods().FindPeriod(ctx, "weekly", weekStart, weekEnd)
+	if err != nil {
+		t.Fatalf("FindPeriod: %v", err)
+	}
+	if week.TotalSales.Cents != 1800 || week.Items["al-pastor"].Quantity != 4 {
+		t.Errorf("rebuilt week = sales %d, items %+v; want 1800 and 4 al-pastor", week.TotalSales.Cents, week.Items)
+	}
+}
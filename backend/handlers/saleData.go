@@ -8,358 +8,171 @@ import (
 	"net/http"
 	"time"
 
-	"tacohut/middlewares"
+	"tacohut/models"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type MenuItem struct {
-	MenuItemId string    `json:"menuItemId" bson:"menuItemId"`
-	Name       string    `json:"name" bson:"name"`
-	Quantity   int       `json:"quantity" bson:"quantity"`
-	Price      int       `json:"price" bson:"price"`
-	Cost       int       `json:"cost" bson:"cost"`
-	Time       time.Time `json:"time" bson:"time"`
-}
-
-type SalesData struct {
-	ID            interface{} `bson:"_id,omitempty"`
-	Items         []MenuItem  `json:"items"`
-	PaymentMethod string      `json:"paymentMethod"`
-	Total         int         `json:"total"`
-	RecordedAt    time.Time   `json:"recordedAt" bson:"recordedAt"`
-}
-
-type AnalyticsSummary struct {
-	ID               primitive.ObjectID `bson:"_id,omitempty"`
-	Period           string             `bson:"period"` // "daily", "weekly", "monthly", "yearly"
-	StartDate        time.Time          `bson:"startDate"`
-	EndDate          time.Time          `bson:"endDate"`
-	ItemsSold        map[string]int     `bson:"itemsSold"`
-	PaymentMethods   map[string]int     `bson:"paymentMethods"`
-	TotalSales       int                `bson:"totalSales"`
-	TotalExpenses    int                `bson:"totalExpenses"`
-	NetProfit        int                `bson:"netProfit"`
-	TransactionCount int                `bson:"transactionCount"`
-	LastUpdated      time.Time          `bson:"lastUpdated"`
-}
-
-func Saledata(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) Saledata(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var sales SalesData
+	var sales models.SalesData
 	err := json.NewDecoder(r.Body).Decode(&sales)
 	if err != nil {
 		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if sales.RecordedAt.IsZero() {
-		sales.RecordedAt = time.Now()
-	}
-
-	fmt.Printf("Received sales with %d items\n", len(sales.Items))
-	fmt.Printf("Payment method: %s\n", sales.PaymentMethod)
-	fmt.Printf("Total amount: %d\n", sales.Total)
-	fmt.Printf("Recorded at: %s\n", sales.RecordedAt.Format(time.RFC3339))
-
+	amounts := []models.Money{sales.Total}
 	for _, item := range sales.Items {
-		fmt.Printf("Item: %s (Qty: %d) - Price: %d, date: %s\n",
-			item.Name, item.Quantity, item.Price, item.Time.Format(time.RFC3339))
+		amounts = append(amounts, item.Price, item.Cost)
 	}
-
-	if middlewares.MongoClient == nil {
-		log.Println("Database connection is nil")
-		http.Error(w, "Database connection error", http.StatusInternalServerError)
+	if err := checkCurrency(amounts...); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkRollupKey("payment method", sales.PaymentMethod); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	collection := middlewares.TacoDB.Collection("dailysales")
+	if sales.RecordedAt.IsZero() {
+		sales.RecordedAt = time.Now()
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	insertResult, err := collection.InsertOne(ctx, sales)
+	// The sale and every rollup it touches are committed together, so a
+	// failed analytics write never leaves the rollups behind the raw sales.
+	var insertedID primitive.ObjectID
+	err = h.store.RunInTransaction(ctx, func(ctx context.Context) error {
+		id, err := h.store.Sales().InsertSale(ctx, sales)
+		if err != nil {
+			return fmt.Errorf("error inserting sales data: %w", err)
+		}
+		sales.ID = id
+
+		if err := h.applySale(ctx, sales, 1); err != nil {
+			return err
+		}
+
+		insertedID = id
+		return nil
+	})
 	if err != nil {
-		log.Printf("Error inserting sales data into MongoDB: %v", err)
-		http.Error(w, "Internal server error: Could not save sales data", http.StatusInternalServerError)
+		log.Printf("Error recording sale: %v", err)
+		http.Error(w, "Internal server error: Could not save sales data and analytics", http.StatusInternalServerError)
 		return
 	}
 
-	fmt.Printf("Successfully inserted sales data with ID: %v\n", insertResult.InsertedID)
+	log.Printf("Inserted sale %s", insertedID.Hex())
 
-	err = UpdateAllAnalytics(sales)
-	if err != nil {
-		log.Printf("Error updating analytics: %v", err)
-	}
+	h.detectAfterSale(sales)
 
 	response := map[string]interface{}{
 		"status":  "success",
 		"message": "Sales data received and saved",
-		"salesId": insertResult.InsertedID,
+		"salesId": insertedID,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-func UpdateAllAnalytics(sales SalesData) error {
-	if err := UpdatePeriodAnalytics(sales, "daily"); err != nil {
-		log.Printf("Error updating daily analytics: %v", err)
+// applySale adds a sale to (sign 1) or takes it out of (sign -1) every
+// rollup: the period rollups and dailyAnalysis.
+func (h *Handler) applySale(ctx context.Context, sales models.SalesData, sign int) error {
+	if err := h.incrementPeriods(ctx, sales.RecordedAt, salePeriodDelta(sales, sign)); err != nil {
+		return err
 	}
-
-	if err := UpdatePeriodAnalytics(sales, "weekly"); err != nil {
-		log.Printf("Error updating weekly analytics: %v", err)
-	}
-
-	if err := UpdatePeriodAnalytics(sales, "monthly"); err != nil {
-		log.Printf("Error updating monthly analytics: %v", err)
+	if err := h.store.Daily().IncrementDay(ctx, h.dayOf(sales.RecordedAt), saleDailyDelta(sales, sign)); err != nil {
+		return fmt.Errorf("error updating daily analysis: %w", err)
 	}
-
-	if err := UpdatePeriodAnalytics(sales, "yearly"); err != nil {
-		log.Printf("Error updating yearly analytics: %v", err)
-	}
-
 	return nil
 }
 
-func UpdatePeriodAnalytics(sales SalesData, period string) error {
-	if middlewares.MongoClient == nil {
-		return fmt.Errorf("database connection is nil")
-	}
-
-	var db *mongo.Database
-	switch period {
-	case "daily":
-		db = middlewares.DailyAnalytics
-	case "weekly":
-		db = middlewares.WeeklyAnalytics
-	case "monthly":
-		db = middlewares.MonthlyAnalytics
-	case "yearly":
-		db = middlewares.YearlyAnalytics
-	default:
-		return fmt.Errorf("invalid period: %s", period)
-	}
-
-	if db == nil {
-		return fmt.Errorf("%s analytics database is nil", period)
-	}
-
-	collection := db.Collection(period + "Analytics")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	startDate, endDate := calculateDateRange(sales.RecordedAt, period)
-
-	var existingAnalytics AnalyticsSummary
-	filter := bson.M{
-		"period":    period,
-		"startDate": startDate,
-		"endDate":   endDate,
-	}
-
-	err := collection.FindOne(ctx, filter).Decode(&existingAnalytics)
-
-	if err == mongo.ErrNoDocuments {
-		return CreateNewPeriodAnalytics(collection, ctx, period, startDate, endDate, sales)
-	} else if err != nil {
-		return fmt.Errorf("error finding %s analytics: %w", period, err)
-	} else {
-		return UpdateExistingPeriodAnalytics(collection, ctx, existingAnalytics, sales)
-	}
-}
-
-func calculateDateRange(timestamp time.Time, period string) (time.Time, time.Time) {
-	switch period {
-	case "daily":
-		start := time.Date(timestamp.Year(), timestamp.Month(), timestamp.Day(), 0, 0, 0, 0, timestamp.Location())
-		end := start.Add(24 * time.Hour).Add(-1 * time.Nanosecond)
-		return start, end
-
-	case "weekly":
-		weekday := int(timestamp.Weekday())
-		if weekday == 0 {
-			weekday = 7
+// incrementPeriods applies delta to the rollup of each configured period
+// containing t. Sales and expenses both go through it. It stops at the
+// first failure; callers run it inside a transaction so nothing partial is
+// kept.
+func (h *Handler) incrementPeriods(ctx context.Context, t time.Time, delta models.AnalyticsDelta) error {
+	for _, period := range h.calendar.PeriodNames() {
+		startDate, endDate := h.calculateDateRange(t, period)
+		if err := h.store.Periods().IncrementPeriod(ctx, period, startDate, endDate, delta); err != nil {
+			return fmt.Errorf("error updating %s analytics: %w", period, err)
 		}
-		start := time.Date(timestamp.Year(), timestamp.Month(), timestamp.Day()-weekday+1, 0, 0, 0, 0, timestamp.Location())
-		end := start.Add(7 * 24 * time.Hour).Add(-1 * time.Nanosecond)
-		return start, end
-
-	case "monthly":
-		start := time.Date(timestamp.Year(), timestamp.Month(), 1, 0, 0, 0, 0, timestamp.Location())
-		end := start.AddDate(0, 1, 0).Add(-1 * time.Nanosecond)
-		return start, end
-
-	case "yearly":
-		start := time.Date(timestamp.Year(), 1, 1, 0, 0, 0, 0, timestamp.Location())
-		end := start.AddDate(1, 0, 0).Add(-1 * time.Nanosecond)
-		return start, end
-
-	default:
-		return timestamp, timestamp
-	}
-}
-
-func CreateNewPeriodAnalytics(collection *mongo.Collection, ctx context.Context, period string, startDate, endDate time.Time, sales SalesData) error {
-	itemsSold := make(map[string]int)
-	paymentMethods := make(map[string]int)
-
-	totalExpenses := 0
-	for _, item := range sales.Items {
-		itemsSold[item.Name] += item.Quantity
-		totalExpenses += item.Cost * item.Quantity
-	}
-
-	paymentMethods[sales.PaymentMethod] = sales.Total
-
-	newAnalytics := AnalyticsSummary{
-		Period:           period,
-		StartDate:        startDate,
-		EndDate:          endDate,
-		ItemsSold:        itemsSold,
-		PaymentMethods:   paymentMethods,
-		TotalSales:       sales.Total,
-		TotalExpenses:    totalExpenses,
-		NetProfit:        sales.Total - totalExpenses,
-		TransactionCount: 1,
-		LastUpdated:      time.Now(),
 	}
-
-	_, err := collection.InsertOne(ctx, newAnalytics)
-	if err != nil {
-		return fmt.Errorf("error creating new %s analytics: %w", period, err)
-	}
-
-	log.Printf("Created new %s analytics for period: %s to %s", period, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
 	return nil
 }
 
-func UpdateExistingPeriodAnalytics(collection *mongo.Collection, ctx context.Context, existingAnalytics AnalyticsSummary, sales SalesData) error {
-	updateItemsSold := bson.M{}
-	for _, item := range sales.Items {
-		key := fmt.Sprintf("itemsSold.%s", item.Name)
-		currentQuantity := existingAnalytics.ItemsSold[item.Name]
-		updateItemsSold[key] = currentQuantity + item.Quantity
-	}
-
-	paymentKey := fmt.Sprintf("paymentMethods.%s", sales.PaymentMethod)
-	//currentPaymentTotal := existingAnalytics.PaymentMethods[sales.PaymentMethod]
-
-	transactionExpenses := 0
-	for _, item := range sales.Items {
-		transactionExpenses += item.Cost * item.Quantity
-	}
-
-	update := bson.M{
-		"$set": bson.M{
-			"lastUpdated": time.Now(),
-		},
-		"$inc": bson.M{
-			"totalSales":       sales.Total,
-			"totalExpenses":    transactionExpenses,
-			"netProfit":        sales.Total - transactionExpenses,
-			"transactionCount": 1,
-		},
-	}
-
-	if paymentKey != "" {
-		update["$inc"].(bson.M)[paymentKey] = sales.Total
-	}
-
-	if len(updateItemsSold) > 0 {
-		for key, value := range updateItemsSold {
-			update["$inc"].(bson.M)[key] = value
+// movePeriods replaces a record's contribution to every period rollup:
+// removed (already negated) comes out of the rollups containing oldAt and
+// added goes into those containing newAt. Where both fall in the same
+// rollup only the difference is written.
+func (h *Handler) movePeriods(ctx context.Context, oldAt time.Time, removed models.AnalyticsDelta, newAt time.Time, added models.AnalyticsDelta) error {
+	for _, period := range h.calendar.PeriodNames() {
+		oldStart, oldEnd := h.calculateDateRange(oldAt, period)
+		newStart, newEnd := h.calculateDateRange(newAt, period)
+
+		var err error
+		if oldStart.Equal(newStart) && oldEnd.Equal(newEnd) {
+			delta := models.AnalyticsDelta{}
+			addDelta(&delta, removed)
+			addDelta(&delta, added)
+			err = h.store.Periods().IncrementPeriod(ctx, period, newStart, newEnd, delta)
+		} else if err = h.store.Periods().IncrementPeriod(ctx, period, oldStart, oldEnd, removed); err == nil {
+			err = h.store.Periods().IncrementPeriod(ctx, period, newStart, newEnd, added)
+		}
+		if err != nil {
+			return fmt.Errorf("error updating %s analytics: %w", period, err)
 		}
 	}
-
-	_, err := collection.UpdateOne(
-		ctx,
-		bson.M{"_id": existingAnalytics.ID},
-		update,
-	)
-
-	if err != nil {
-		return fmt.Errorf("error updating %s analytics: %w", existingAnalytics.Period, err)
-	}
-
-	log.Printf("Updated %s analytics for period: %s to %s", existingAnalytics.Period, existingAnalytics.StartDate.Format("2006-01-02"), existingAnalytics.EndDate.Format("2006-01-02"))
 	return nil
 }
 
-func GetAnalytics(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	period := r.URL.Query().Get("period") // daily, weekly, monthly, yearly
-	dateParam := r.URL.Query().Get("date")
-
-	if period == "" {
-		http.Error(w, "Period parameter is required (daily, weekly, monthly, yearly)", http.StatusBadRequest)
-		return
-	}
-
-	var targetDate time.Time
-	var err error
+// calculateDateRange returns the first and last instant of the business
+// period containing timestamp.
+func (h *Handler) calculateDateRange(timestamp time.Time, period string) (time.Time, time.Time) {
+	return h.calendar.Range(timestamp, period)
+}
 
-	if dateParam == "" {
-		targetDate = time.Now()
-	} else {
-		targetDate, err = time.Parse("2006-01-02", dateParam)
-		if err != nil {
-			http.Error(w, "Invalid date format. Use YYYY-MM-DD", http.StatusBadRequest)
-			return
-		}
+// salePeriodDelta is the change a sale makes to a period rollup. Sign is 1
+// when the sale is recorded and -1 when it is taken back out. Item cost
+// goes to cost of goods, which also counts towards total expenses.
+func salePeriodDelta(sales models.SalesData, sign int) models.AnalyticsDelta {
+	delta := models.AnalyticsDelta{
+		ItemsSold:        make(map[string]int),
+		Items:            make(map[string]models.ItemDelta),
+		PaymentMethods:   map[string]int64{sales.PaymentMethod: sales.Total.Mul(sign).Cents},
+		TotalSales:       sales.Total.Mul(sign).Cents,
+		TransactionCount: sign,
 	}
 
-	var db *mongo.Database
-	switch period {
-	case "daily":
-		db = middlewares.DailyAnalytics
-	case "weekly":
-		db = middlewares.WeeklyAnalytics
-	case "monthly":
-		db = middlewares.MonthlyAnalytics
-	case "yearly":
-		db = middlewares.YearlyAnalytics
-	default:
-		http.Error(w, "Invalid period. Use: daily, weekly, monthly, yearly", http.StatusBadRequest)
-		return
-	}
+	for _, item := range sales.Items {
+		delta.ItemsSold[item.Name] += sign * item.Quantity
+		delta.CostOfGoods += item.Cost.Mul(sign * item.Quantity).Cents
 
-	if db == nil {
-		http.Error(w, "Analytics database not available", http.StatusInternalServerError)
-		return
+		key := itemKey(item)
+		d := delta.Items[key]
+		d.Name = item.Name
+		d.Quantity += sign * item.Quantity
+		d.Revenue += item.Price.Mul(sign * item.Quantity).Cents
+		d.Cost += item.Cost.Mul(sign * item.Quantity).Cents
+		delta.Items[key] = d
 	}
+	delta.TotalExpenses = delta.CostOfGoods
 
-	collection := db.Collection(period + "Analytics")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	startDate, endDate := calculateDateRange(targetDate, period)
-
-	var analytics AnalyticsSummary
-	err = collection.FindOne(ctx, bson.M{
-		"period":    period,
-		"startDate": startDate,
-		"endDate":   endDate,
-	}).Decode(&analytics)
+	return delta
+}
 
-	if err == mongo.ErrNoDocuments {
-		http.Error(w, fmt.Sprintf("No %s analytics found for the specified date", period), http.StatusNotFound)
-		return
-	} else if err != nil {
-		log.Printf("Error fetching %s analytics: %v", period, err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+// itemKey identifies a menu item in the rollups. Sales recorded before
+// items carried an id fall back to the display name.
+func itemKey(item models.MenuItem) string {
+	if item.MenuItemId != "" {
+		return item.MenuItemId
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(analytics)
-}
\ No newline at end of file
+	return item.Name
+}
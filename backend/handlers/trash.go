@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"tacohut/models"
+	"tacohut/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FetchTrash lists voided sales and expenses, most recently voided first.
+func (h *Handler) FetchTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sales, err := h.store.Sales().ListVoidedSales(ctx)
+	if err != nil {
+		log.Printf("Error fetching voided sales: %v", err)
+		http.Error(w, "Failed to fetch trash", http.StatusInternalServerError)
+		return
+	}
+
+	expenses, err := h.store.Expenses().ListVoidedExpenses(ctx)
+	if err != nil {
+		log.Printf("Error fetching voided expenses: %v", err)
+		http.Error(w, "Failed to fetch trash", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"status": "success",
+		"data": map[string]interface{}{
+			"sales":    sales,
+			"expenses": expenses,
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error: Could not encode response", http.StatusInternalServerError)
+	}
+}
+
+// RestoreSale serves POST /api/sales/{id}/restore, putting a voided sale
+// back into listings and rollups.
+func (h *Handler) RestoreSale(w http.ResponseWriter, r *http.Request) {
+	objID, ok := restoreID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var sale models.SalesData
+	err := h.store.RunInTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		sale, err = h.store.Sales().FindSale(ctx, objID)
+		if err != nil {
+			return err
+		}
+		if sale.Voided == nil {
+			return errNotVoided
+		}
+
+		if err := h.store.Sales().SetSaleVoid(ctx, objID, nil); err != nil {
+			return err
+		}
+		return h.applySale(ctx, sale, 1)
+	})
+	if err == nil {
+		sale.Voided = nil
+		h.detectAfterSale(sale)
+	}
+	writeRestoreResult(w, "Sale", objID, err)
+}
+
+// RestoreExpense serves POST /api/expenses/{id}/restore.
+func (h *Handler) RestoreExpense(w http.ResponseWriter, r *http.Request) {
+	objID, ok := restoreID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var expense models.ExpensesFetched
+	err := h.store.RunInTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		expense, err = h.store.Expenses().FindExpense(ctx, objID)
+		if err != nil {
+			return err
+		}
+		if expense.Voided == nil {
+			return errNotVoided
+		}
+
+		if err := h.store.Expenses().SetExpenseVoid(ctx, objID, nil); err != nil {
+			return err
+		}
+		return h.applyExpense(ctx, expenseOf(expense), 1)
+	})
+	if err == nil {
+		expense.Voided = nil
+		h.detectAfterExpense(expense)
+	}
+	writeRestoreResult(w, "Expense", objID, err)
+}
+
+// restoreID checks the method and reads the id from .../{id}/restore.
+func restoreID(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return primitive.NilObjectID, false
+	}
+
+	pathSegments := strings.Split(strings.TrimSuffix(r.URL.Path, "/restore"), "/")
+	id := pathSegments[len(pathSegments)-1]
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return primitive.NilObjectID, false
+	}
+	return objID, true
+}
+
+func writeRestoreResult(w http.ResponseWriter, kind string, id primitive.ObjectID, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, kind+" not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, errNotVoided) {
+		http.Error(w, kind+" is not voided", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error restoring %s %s: %v", strings.ToLower(kind), id.Hex(), err)
+		http.Error(w, "Error restoring "+strings.ToLower(kind), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Restored",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"tacohut/models"
+	"tacohut/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// expensePatch holds the fields of a PATCH request; missing fields keep
+// their stored value.
+type expensePatch struct {
+	Amount        *models.Money `json:"amount"`
+	Category      *string       `json:"category"`
+	Description   *string       `json:"description"`
+	PaymentMethod *string       `json:"paymentMethod"`
+	TimeAdded     *time.Time    `json:"timeAdded"`
+}
+
+// UpdateExpense serves PATCH /api/expenses/{id}. A new amount or category
+// moves money between expense category buckets, and a new timeAdded moves
+// the expense between days and periods; the stores recompute each touched
+// rollup's net profit.
+func (h *Handler) UpdateExpense(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PATCH" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pathSegments := strings.Split(r.URL.Path, "/")
+	id := pathSegments[len(pathSegments)-1]
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	var patch expensePatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if patch.Amount != nil {
+		if err := checkCurrency(*patch.Amount); err != nil {
+			http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if patch.Category != nil && strings.TrimSpace(*patch.Category) == "" {
+		http.Error(w, "Bad request: category cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if patch.Category != nil {
+		if err := checkRollupKey("category", *patch.Category); err != nil {
+			http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var updated models.ExpensesFetched
+	err = h.store.RunInTransaction(ctx, func(ctx context.Context) error {
+		old, err := h.store.Expenses().FindExpense(ctx, objID)
+		if err != nil {
+			return err
+		}
+		if old.Voided != nil {
+			return errAlreadyVoided
+		}
+
+		updated = applyExpensePatch(old, patch)
+		if err := h.store.Expenses().ReplaceExpense(ctx, objID, updated); err != nil {
+			return err
+		}
+		return h.replaceExpenseAnalytics(ctx, expenseOf(old), expenseOf(updated))
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Expense not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, errAlreadyVoided) {
+		http.Error(w, "Expense is voided, restore it before editing", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error updating expense %s: %v", id, err)
+		http.Error(w, "Internal server error: Could not update expense", http.StatusInternalServerError)
+		return
+	}
+
+	h.detectAfterExpense(updated)
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Expense updated",
+		"data":    updated,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func applyExpensePatch(old models.ExpensesFetched, patch expensePatch) models.ExpensesFetched {
+	expense := old
+	if patch.Amount != nil {
+		expense.Amount = *patch.Amount
+	}
+	if patch.Category != nil {
+		expense.Category = strings.TrimSpace(*patch.Category)
+	}
+	if patch.Description != nil {
+		expense.Description = *patch.Description
+	}
+	if patch.PaymentMethod != nil {
+		expense.PaymentMethod = *patch.PaymentMethod
+	}
+	if patch.TimeAdded != nil && !patch.TimeAdded.IsZero() {
+		expense.TimeAdded = *patch.TimeAdded
+	}
+	return expense
+}
+
+// replaceExpenseAnalytics moves an expense's contribution from old to
+// updated, as one increment per rollup both fall in.
+func (h *Handler) replaceExpenseAnalytics(ctx context.Context, old, updated models.Expenses) error {
+	if err := h.movePeriods(ctx, old.TimeAdded, expenseDelta(old, -1), updated.TimeAdded, expenseDelta(updated, 1)); err != nil {
+		return err
+	}
+	if err := h.moveDay(ctx, old.TimeAdded, expenseDelta(old, -1), updated.TimeAdded, expenseDelta(updated, 1)); err != nil {
+		return fmt.Errorf("error updating daily expenses: %w", err)
+	}
+	return nil
+}
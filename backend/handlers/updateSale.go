@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"tacohut/models"
+	"tacohut/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// salePatch holds the fields of an edit request. Fields left out of a
+// PATCH keep their stored value; PUT must send items, paymentMethod and
+// total.
+type salePatch struct {
+	Items         *[]models.MenuItem `json:"items"`
+	PaymentMethod *string            `json:"paymentMethod"`
+	Total         *models.Money      `json:"total"`
+	RecordedAt    *time.Time         `json:"recordedAt"`
+}
+
+// UpdateSale serves PUT and PATCH /api/sales/{id}. The old version of the
+// sale is taken out of every rollup and the new one added, in the same
+// transaction as the write, so moving a sale to another day also moves it
+// between every period rollup.
+func (h *Handler) UpdateSale(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" && r.Method != "PATCH" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pathSegments := strings.Split(r.URL.Path, "/")
+	id := pathSegments[len(pathSegments)-1]
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	var patch salePatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Method == "PUT" && (patch.Items == nil || patch.PaymentMethod == nil || patch.Total == nil) {
+		http.Error(w, "Bad request: PUT needs items, paymentMethod and total", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var old, updated models.SalesData
+	err = h.store.RunInTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		old, err = h.store.Sales().FindSale(ctx, objID)
+		if err != nil {
+			return err
+		}
+		if old.Voided != nil {
+			return errAlreadyVoided
+		}
+
+		updated = applySalePatch(old, patch)
+		if err := validateSale(updated); err != nil {
+			return err
+		}
+
+		if err := h.store.Sales().ReplaceSale(ctx, objID, updated); err != nil {
+			return err
+		}
+		return h.replaceSaleAnalytics(ctx, old, updated)
+	})
+	var invalid invalidSaleError
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Sale not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, errAlreadyVoided) {
+		http.Error(w, "Sale is voided, restore it before editing", http.StatusConflict)
+		return
+	} else if errors.As(err, &invalid) {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Error updating sale %s: %v", id, err)
+		http.Error(w, "Internal server error: Could not update sale and analytics", http.StatusInternalServerError)
+		return
+	}
+
+	h.detectAfterSale(updated, old.RecordedAt)
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Sale updated",
+		"data":    updated,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// applySalePatch returns old with the patched fields replaced. When the
+// items change without a new total, the total is recomputed from them.
+func applySalePatch(old models.SalesData, patch salePatch) models.SalesData {
+	sale := old
+	if patch.Items != nil {
+		sale.Items = *patch.Items
+		if patch.Total == nil {
+			sale.Total = models.NewMoney(0)
+			for _, item := range sale.Items {
+				sale.Total = sale.Total.Add(item.Price.Mul(item.Quantity))
+			}
+		}
+	}
+	if patch.PaymentMethod != nil {
+		sale.PaymentMethod = *patch.PaymentMethod
+	}
+	if patch.Total != nil {
+		sale.Total = *patch.Total
+	}
+	if patch.RecordedAt != nil && !patch.RecordedAt.IsZero() {
+		sale.RecordedAt = *patch.RecordedAt
+	}
+	return sale
+}
+
+// invalidSaleError is a sale edit that fails validation; it is reported to
+// the client as a bad request.
+type invalidSaleError struct{ reason string }
+
+func (e invalidSaleError) Error() string { return e.reason }
+
+func validateSale(sale models.SalesData) error {
+	amounts := []models.Money{sale.Total}
+	for _, item := range sale.Items {
+		if item.Quantity < 0 {
+			return invalidSaleError{fmt.Sprintf("item %s has a negative quantity", item.Name)}
+		}
+		amounts = append(amounts, item.Price, item.Cost)
+	}
+	if err := checkCurrency(amounts...); err != nil {
+		return invalidSaleError{err.Error()}
+	}
+	if err := checkRollupKey("payment method", sale.PaymentMethod); err != nil {
+		return invalidSaleError{err.Error()}
+	}
+	return nil
+}
+
+// replaceSaleAnalytics moves every rollup from old to updated. Where both
+// versions fall in the same rollup only the difference is written.
+func (h *Handler) replaceSaleAnalytics(ctx context.Context, old, updated models.SalesData) error {
+	if err := h.movePeriods(ctx, old.RecordedAt, salePeriodDelta(old, -1), updated.RecordedAt, salePeriodDelta(updated, 1)); err != nil {
+		return err
+	}
+	if err := h.moveDay(ctx, old.RecordedAt, saleDailyDelta(old, -1), updated.RecordedAt, saleDailyDelta(updated, 1)); err != nil {
+		return fmt.Errorf("error updating daily analysis: %w", err)
+	}
+	return nil
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"sync"
+	"time"
 
 	"tacohut/handlers"
-	"tacohut/middlewares"
+	"tacohut/models"
+	"tacohut/store"
 
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
@@ -22,23 +25,82 @@ func main() {
 	doOnce.Do(func() {
 		err := godotenv.Load()
 		if err != nil {
-			log.Fatalf("Error loading .env file!")
+			log.Println("No .env file loaded, using the process environment")
 		}
 	})
 
+	if currency := os.Getenv("CURRENCY"); currency != "" {
+		models.Currency = currency
+	}
+
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	port := os.Getenv("PORT")
 
-	mux.HandleFunc("/", handlers.HandleRoot)
-	mux.HandleFunc("/api/saledata", handlers.Saledata)
-	mux.HandleFunc("/api/fetchSaleData", handlers.FetchSaleData)
-	mux.HandleFunc("/api/expenseData", handlers.HandleExpense)
-	mux.HandleFunc("/close", handlers.HandleClose)
-	mux.HandleFunc("/api/sales/{id}", handlers.DeleteSale)
-	mux.HandleFunc("/api/fetchExpense", handlers.FetchExpenses)
-	mux.HandleFunc("/api/expenses/{id}", handlers.DeleteExpenses)
-	mux.HandleFunc("/api/daily", handlers.FetchDailyAnalysis)
+	db, err := openStore(os.Getenv("STORE_BACKEND"))
+	if err != nil {
+		log.Fatalf("Error opening store: %v", err)
+	}
+
+	if err := migrateStore(context.Background(), db); err != nil {
+		log.Fatalf("Error migrating store: %v", err)
+	}
+
+	if indexer, ok := db.(store.Indexer); ok {
+		if err := indexer.EnsureIndexes(context.Background()); err != nil {
+			log.Fatalf("Error creating indexes: %v", err)
+		}
+	}
+
+	calendar, err := handlers.LoadCalendar()
+	if err != nil {
+		log.Fatalf("Error loading business calendar: %v", err)
+	}
+
+	h := handlers.New(db, calendar)
+	if err := h.SyncCalendar(context.Background()); err != nil {
+		log.Fatalf("Error syncing analytics with the business calendar: %v", err)
+	}
+
+	mux.HandleFunc("/", h.HandleRoot)
+	mux.HandleFunc("/api/saledata", h.Saledata)
+	mux.HandleFunc("/api/fetchSaleData", h.FetchSaleData)
+	mux.HandleFunc("/api/expenseData", h.HandleExpense)
+	mux.HandleFunc("/close", h.HandleClose)
+	mux.HandleFunc("/api/sales/{id}", h.DeleteSale)
+	mux.HandleFunc("PUT /api/sales/{id}", h.UpdateSale)
+	mux.HandleFunc("PATCH /api/sales/{id}", h.UpdateSale)
+	mux.HandleFunc("/api/sales/{id}/restore", h.RestoreSale)
+	mux.HandleFunc("/api/fetchExpense", h.FetchExpenses)
+	mux.HandleFunc("/api/expenses/{id}", h.DeleteExpenses)
+	mux.HandleFunc("PATCH /api/expenses/{id}", h.UpdateExpense)
+	mux.HandleFunc("/api/expenses/{id}/restore", h.RestoreExpense)
+	mux.HandleFunc("/api/trash", h.FetchTrash)
+	mux.HandleFunc("/api/daily", h.FetchDailyAnalysis)
+	mux.HandleFunc("/api/analytics", h.GetAnalytics)
+	mux.HandleFunc("/api/analytics/compare", h.CompareAnalytics)
+	mux.HandleFunc("/api/analytics/heatmap", h.GetSalesHeatmap)
+	mux.HandleFunc("/api/analytics/items", h.GetItemProfit)
+	mux.HandleFunc("/api/analytics/menu-engineering", h.GetMenuEngineering)
+	mux.HandleFunc("/api/analytics/basket", h.GetBasketAnalysis)
+	mux.HandleFunc("/api/analytics/forecast", h.GetSalesForecast)
+	mux.HandleFunc("/api/reports/pnl", h.GetProfitAndLoss)
+	mux.HandleFunc("/api/reports/cashflow", h.GetCashFlow)
+	mux.HandleFunc("/api/admin/analytics/rebuild", h.RebuildAnalyticsHandler)
+	mux.HandleFunc("/api/admin/analytics/verify", h.RebuildAnalyticsHandler)
+	mux.HandleFunc("/api/anomalies", h.FetchAnomalies)
+	mux.HandleFunc("/api/anomalies/{id}/acknowledge", h.AcknowledgeAnomaly)
+	mux.HandleFunc("/api/admin/anomalies/scan", h.ScanAnomaliesHandler)
 
-	handlerWithDB := middlewares.ConnectDb(mux)
+	interval, err := anomalyScanInterval()
+	if err != nil {
+		log.Fatalf("Error reading ANOMALY_SCAN_INTERVAL: %v", err)
+	}
+	if interval > 0 {
+		go h.RunAnomalySchedule(context.Background(), interval)
+	}
 
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:5173"},
@@ -47,7 +109,7 @@ func main() {
 		AllowCredentials: false,
 		Debug:            false,
 	})
-	finalHandler := c.Handler(handlerWithDB)
+	finalHandler := c.Handler(mux)
 
 	fmt.Println("Server listening in port", port)
 
@@ -55,3 +117,53 @@ func main() {
 		log.Fatal("Error creating server", err)
 	}
 }
+
+// openStore picks the storage backend named by STORE_BACKEND. Mongo is the
+// default; "bolt" keeps everything in the local file named by STORE_PATH
+// and "memory" runs without any database at all.
+func openStore(backend string) (store.Store, error) {
+	switch backend {
+	case "", "mongo":
+		return store.ConnectMongo(context.Background(), os.Getenv("DB_URI"))
+	case "bolt":
+		path := os.Getenv("STORE_PATH")
+		if path == "" {
+			path = "tacohut.db"
+		}
+		return store.OpenBolt(path)
+	case "memory":
+		fmt.Println("Using in-memory store, data will not survive a restart")
+		return store.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown STORE_BACKEND %q (use mongo, bolt or memory)", backend)
+	}
+}
+
+// migrateStore brings a persistent store up to the current schema. The
+// in-memory store starts empty and has nothing to migrate.
+func migrateStore(ctx context.Context, db store.Store) error {
+	migrator, ok := db.(store.Migrator)
+	if !ok {
+		return nil
+	}
+
+	ran, err := migrator.Migrate(ctx)
+	for _, m := range ran {
+		fmt.Printf("Applied migration %d: %s\n", m.Version, m.Description)
+	}
+	return err
+}
+
+// anomalyScanInterval reads ANOMALY_SCAN_INTERVAL, a Go duration such as
+// 30m. It defaults to an hour; 0 turns the scheduled scan off.
+func anomalyScanInterval() (time.Duration, error) {
+	value := os.Getenv("ANOMALY_SCAN_INTERVAL")
+	if value == "" {
+		return time.Hour, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("invalid duration %q, use e.g. 30m or 0 to disable", value)
+	}
+	return interval, nil
+}
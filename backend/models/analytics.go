@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AnalyticsSummary is one period rollup. TotalExpenses is CostOfGoods,
+// the item cost of what was sold, plus OperatingExpenses, the recorded
+// expenses split by category in ExpenseCategories; GrossProfit is sales
+// less cost of goods and NetProfit sales less both.
+type AnalyticsSummary struct {
+	ID                primitive.ObjectID   `json:"id,omitzero" bson:"_id,omitempty"`
+	Period            string               `json:"period" bson:"period"` // "daily", "weekly", "monthly", "yearly"
+	StartDate         time.Time            `json:"startDate" bson:"startDate"`
+	EndDate           time.Time            `json:"endDate" bson:"endDate"`
+	ItemsSold         map[string]int       `json:"itemsSold" bson:"itemsSold"`
+	Items             map[string]ItemStats `json:"items" bson:"items"` // by MenuItemId
+	PaymentMethods    map[string]Money     `json:"paymentMethods" bson:"paymentMethods"`
+	TotalSales        Money                `json:"totalSales" bson:"totalSales"`
+	CostOfGoods       Money                `json:"costOfGoods" bson:"costOfGoods"`
+	OperatingExpenses Money                `json:"operatingExpenses" bson:"operatingExpenses"`
+	ExpenseCategories map[string]Money     `json:"expenseCategories" bson:"expenseCategories"`
+	TotalExpenses     Money                `json:"totalExpenses" bson:"totalExpenses"`
+	GrossProfit       Money                `json:"grossProfit" bson:"grossProfit"`
+	NetProfit         Money                `json:"netProfit" bson:"netProfit"`
+	TransactionCount  int                  `json:"transactionCount" bson:"transactionCount"`
+	LastUpdated       time.Time            `json:"lastUpdated" bson:"lastUpdated"`
+}
+
+// ItemStats is what one menu item sold in a period. Name is the display
+// name it was last sold under; Margin is Revenue less Cost.
+type ItemStats struct {
+	Name     string `json:"name" bson:"name"`
+	Quantity int    `json:"quantity" bson:"quantity"`
+	Revenue  Money  `json:"revenue" bson:"revenue"`
+	Cost     Money  `json:"cost" bson:"cost"`
+	Margin   Money  `json:"margin" bson:"margin"`
+}
+
+type DailyData struct { // can also be the struct for weekly, monthly and yearly
+	ID              interface{}      `bson:"_id,omitempty"`
+	Date            time.Time        `bson:"date"`
+	ItemsSold       map[string]int   `bson:"itemsSold"`
+	PaymentSummary  map[string]int   `bson:"paymentSummary"` // transactions per payment method
+	TotalSales      Money            `bson:"totalSales"`
+	TotalExpenses   Money            `bson:"totalExpenses"`
+	NetProfit       Money            `bson:"netProfit"`
+	ExpenseCategory map[string]Money `bson:"expenseCategory"`
+	LastUpdated     time.Time        `bson:"lastUpdated"`
+}
+
+// AnalyticsDelta is an increment applied to a daily or period rollup.
+// Negative values undo an earlier increment; profits are always derived
+// from the resulting sales and expense totals. Amounts are in cents of
+// Currency; PaymentMethods holds cents for period rollups and transaction
+// counts for dailyAnalysis. TotalExpenses includes CostOfGoods, which only
+// period rollups track.
+type AnalyticsDelta struct {
+	ItemsSold         map[string]int
+	Items             map[string]ItemDelta // by MenuItemId, period rollups only
+	PaymentMethods    map[string]int64
+	ExpenseCategories map[string]int64
+	TotalSales        int64
+	TotalExpenses     int64
+	CostOfGoods       int64
+	TransactionCount  int
+}
+
+// ItemDelta is the AnalyticsDelta of one menu item. Revenue and Cost are
+// cents.
+type ItemDelta struct {
+	Name     string
+	Quantity int
+	Revenue  int64
+	Cost     int64
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Anomaly kinds.
+const (
+	AnomalyLowSales    = "lowSales"    // a day far below its weekday baseline
+	AnomalySaleTotal   = "saleTotal"   // a sale whose total does not match its items
+	AnomalyHighExpense = "highExpense" // an expense far above its category norm
+)
+
+// Anomaly severities, as shown in the alerts list.
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+)
+
+// Anomaly is unusual activity flagged by the detector. Key names what was
+// checked, e.g. "saleTotal:<sale id>" or "lowSales:2024-03-05", so
+// checking it again updates the same anomaly instead of adding another.
+// Subject is the id of the sale or expense, or the business date.
+type Anomaly struct {
+	ID             primitive.ObjectID `json:"id,omitzero" bson:"_id,omitempty"`
+	Key            string             `json:"key" bson:"key"`
+	Kind           string             `json:"kind" bson:"kind"`
+	Severity       string             `json:"severity" bson:"severity"`
+	Title          string             `json:"title" bson:"title"`
+	Message        string             `json:"message" bson:"message"`
+	Subject        string             `json:"subject" bson:"subject"`
+	OccurredAt     time.Time          `json:"occurredAt" bson:"occurredAt"`
+	DetectedAt     time.Time          `json:"detectedAt" bson:"detectedAt"`
+	Acknowledged   bool               `json:"acknowledged" bson:"acknowledged"`
+	AcknowledgedAt *time.Time         `json:"acknowledgedAt,omitempty" bson:"acknowledgedAt,omitempty"`
+}
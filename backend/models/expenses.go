@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type Expenses struct {
+	Amount        Money     `json:"amount" bson:"amount"`
+	Category      string    `json:"category" bson:"category"`
+	Description   string    `json:"description" bson:"description"`
+	PaymentMethod string    `json:"paymentMethod" bson:"paymentMethod"`
+	TimeAdded     time.Time `json:"timeAdded" bson:"timeAdded"`
+}
+
+type ExpensesFetched struct {
+	ID            interface{} `bson:"_id,omitempty"`
+	Amount        Money       `json:"amount" bson:"amount"`
+	Category      string      `json:"category" bson:"category"`
+	Description   string      `json:"description" bson:"description"`
+	PaymentMethod string      `json:"paymentMethod" bson:"paymentMethod"`
+	TimeAdded     time.Time   `json:"timeAdded" bson:"timeAdded"`
+	Voided        *Void       `json:"voided,omitempty" bson:"voided,omitempty"`
+}
@@ -0,0 +1,220 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Currency is the ISO 4217 code the shop trades in. Amounts that arrive
+// without a currency (bare JSON numbers, legacy documents) are taken to be
+// in this currency.
+var Currency = "KES"
+
+// Money is an amount in minor units (cents) of an ISO 4217 currency.
+//
+// In BSON it is stored as {cents, currency}. Older documents held plain
+// whole-shilling numbers or numeric strings; those still decode, as major
+// units in Currency. In JSON it travels as a number of major units so the
+// frontend keeps working, and decoding also accepts numeric strings and
+// {"cents", "currency"} objects.
+type Money struct {
+	Cents    int64
+	Currency string
+}
+
+func NewMoney(cents int64) Money {
+	return Money{Cents: cents, Currency: Currency}
+}
+
+// CurrencyCode returns the currency, defaulting zero values to Currency.
+func (m Money) CurrencyCode() string {
+	if m.Currency == "" {
+		return Currency
+	}
+	return m.Currency
+}
+
+// Add and Sub keep m's currency, or o's if m has none. They do not
+// convert: handlers reject amounts in other currencies with checkCurrency
+// before any arithmetic.
+func (m Money) Add(o Money) Money {
+	return Money{Cents: m.Cents + o.Cents, Currency: m.pickCurrency(o)}
+}
+
+func (m Money) Sub(o Money) Money {
+	return Money{Cents: m.Cents - o.Cents, Currency: m.pickCurrency(o)}
+}
+
+func (m Money) Mul(n int) Money {
+	return Money{Cents: m.Cents * int64(n), Currency: m.Currency}
+}
+
+func (m Money) pickCurrency(o Money) string {
+	if m.Currency != "" {
+		return m.Currency
+	}
+	return o.Currency
+}
+
+func (m Money) IsZero() bool {
+	return m.Cents == 0
+}
+
+// Major formats the amount in major units with no trailing zeros,
+// e.g. "150", "150.5", "-0.05".
+func (m Money) Major() string {
+	cents := m.Cents
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	whole, frac := cents/100, cents%100
+	if frac == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	return strings.TrimRight(fmt.Sprintf("%s%d.%02d", sign, whole, frac), "0")
+}
+
+func (m Money) String() string {
+	return m.CurrencyCode() + " " + m.Major()
+}
+
+// ParseMoney reads a decimal amount in major units, such as "1,200" or
+// "99.50", without going through floating point.
+func ParseMoney(s string) (Money, error) {
+	cleaned := strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	if cleaned == "" {
+		return Money{}, fmt.Errorf("empty amount")
+	}
+
+	negative := strings.HasPrefix(cleaned, "-")
+	cleaned = strings.TrimPrefix(cleaned, "-")
+
+	wholePart, fracPart, _ := strings.Cut(cleaned, ".")
+	if wholePart == "" {
+		wholePart = "0"
+	}
+	whole, err := strconv.ParseInt(wholePart, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+
+	var frac int64
+	if fracPart != "" {
+		for _, c := range fracPart {
+			if c < '0' || c > '9' {
+				return Money{}, fmt.Errorf("invalid amount %q", s)
+			}
+		}
+		// Round half away from zero on the third decimal.
+		n, _ := strconv.ParseInt((fracPart + "000")[:3], 10, 64)
+		frac = (n + 5) / 10
+	}
+
+	cents := whole*100 + frac
+	if negative {
+		cents = -cents
+	}
+	return NewMoney(cents), nil
+}
+
+// moneyFromMajor converts a floating point amount in major units.
+func moneyFromMajor(f float64) Money {
+	if f < 0 {
+		return NewMoney(-int64(-f*100 + 0.5))
+	}
+	return NewMoney(int64(f*100 + 0.5))
+}
+
+type moneyDoc struct {
+	Cents    int64  `json:"cents" bson:"cents"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.Major()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	trimmed := strings.TrimSpace(string(data))
+	switch {
+	case trimmed == "null":
+		*m = Money{}
+		return nil
+
+	case strings.HasPrefix(trimmed, "{"):
+		var doc moneyDoc
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		*m = Money{Cents: doc.Cents, Currency: doc.Currency}
+		if m.Currency == "" {
+			m.Currency = Currency
+		}
+		return nil
+
+	case strings.HasPrefix(trimmed, `"`):
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := ParseMoney(s)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+
+	default:
+		parsed, err := ParseMoney(trimmed)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+}
+
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(moneyDoc{Cents: m.Cents, Currency: m.CurrencyCode()})
+}
+
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bsoncore.Value{Type: t, Data: data}
+
+	switch t {
+	case bsontype.EmbeddedDocument:
+		var doc moneyDoc
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		*m = Money{Cents: doc.Cents, Currency: doc.Currency}
+		if m.Currency == "" {
+			m.Currency = Currency
+		}
+	case bsontype.Int32:
+		*m = NewMoney(int64(value.Int32()) * 100)
+	case bsontype.Int64:
+		*m = NewMoney(value.Int64() * 100)
+	case bsontype.Double:
+		*m = moneyFromMajor(value.Double())
+	case bsontype.String:
+		parsed, err := ParseMoney(value.StringValue())
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case bsontype.Null, bsontype.Undefined:
+		*m = Money{}
+	default:
+		return fmt.Errorf("cannot decode %s into Money", t)
+	}
+	return nil
+}
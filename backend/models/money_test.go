@@ -0,0 +1,211 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in    string
+		cents int64
+		err   bool
+	}{
+		{"150", 15000, false},
+		{"99.50", 9950, false},
+		{"99.5", 9950, false},
+		{"1,200", 120000, false},
+		{" 350 ", 35000, false},
+		{".75", 75, false},
+		{"0.005", 1, false},
+		{"0.004", 0, false},
+		{"-12.25", -1225, false},
+		{"-0.05", -5, false},
+		{"", 0, true},
+		{"12a", 0, true},
+		{"1.2.3", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseMoney(%q) error = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+		if !tt.err && (got.Cents != tt.cents || got.Currency != Currency) {
+			t.Errorf("ParseMoney(%q) = %+v, want %d cents", tt.in, got, tt.cents)
+		}
+	}
+}
+
+func TestMoneyMajor(t *testing.T) {
+	tests := []struct {
+		cents int64
+		want  string
+	}{
+		{15000, "150"},
+		{15050, "150.5"},
+		{15005, "150.05"},
+		{0, "0"},
+		{-5, "-0.05"},
+		{-1225, "-12.25"},
+	}
+
+	for _, tt := range tests {
+		if got := NewMoney(tt.cents).Major(); got != tt.want {
+			t.Errorf("NewMoney(%d).Major() = %q, want %q", tt.cents, got, tt.want)
+		}
+	}
+	if got := NewMoney(-1225).String(); got != Currency+" -12.25" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	a, b := NewMoney(1050), NewMoney(-300)
+	if got := a.Add(b); got != NewMoney(750) {
+		t.Errorf("Add = %+v, want 750", got)
+	}
+	if got := a.Sub(b); got != NewMoney(1350) {
+		t.Errorf("Sub = %+v, want 1350", got)
+	}
+	if got := a.Mul(-3); got != NewMoney(-3150) {
+		t.Errorf("Mul = %+v, want -3150", got)
+	}
+
+	// Floating point would make this 0.30000000000000004.
+	var tenth, fifth Money
+	json.Unmarshal([]byte("0.1"), &tenth)
+	json.Unmarshal([]byte("0.2"), &fifth)
+	if sum := tenth.Add(fifth); sum.Cents != 30 || sum.Major() != "0.3" {
+		t.Errorf("0.1 + 0.2 = %+v", sum)
+	}
+	if got := moneyFromMajor(0.1 + 0.2); got.Cents != 30 {
+		t.Errorf("moneyFromMajor(0.1 + 0.2) = %d cents, want 30", got.Cents)
+	}
+}
+
+func TestMoneyMixedCurrencies(t *testing.T) {
+	kes := Money{Cents: 1000, Currency: "KES"}
+	usd := Money{Cents: 200, Currency: "USD"}
+	var zero Money
+
+	tests := []struct {
+		name     string
+		got      Money
+		cents    int64
+		currency string
+	}{
+		{"add keeps the receiver's currency", kes.Add(usd), 1200, "KES"},
+		{"sub keeps the receiver's currency", usd.Sub(kes), -800, "USD"},
+		{"zero takes the other currency on add", zero.Add(usd), 200, "USD"},
+		{"zero takes the other currency on sub", zero.Sub(kes), -1000, "KES"},
+		{"zero operand keeps the currency", kes.Add(zero), 1000, "KES"},
+	}
+
+	for _, tt := range tests {
+		if tt.got.Cents != tt.cents || tt.got.Currency != tt.currency {
+			t.Errorf("%s: got %+v, want %d %s", tt.name, tt.got, tt.cents, tt.currency)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	for _, cents := range []int64{0, 5, 9950, 120000, -1225} {
+		data, err := json.Marshal(NewMoney(cents))
+		if err != nil {
+			t.Fatalf("Marshal(%d): %v", cents, err)
+		}
+		var got Money
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", data, err)
+		}
+		if got != NewMoney(cents) {
+			t.Errorf("round trip of %d cents through %s = %+v", cents, data, got)
+		}
+	}
+
+	tests := []struct {
+		in       string
+		cents    int64
+		currency string
+	}{
+		{`99.5`, 9950, Currency},
+		{`"1,200"`, 120000, Currency},
+		{`{"cents": 250, "currency": "USD"}`, 250, "USD"},
+		{`{"cents": 250}`, 250, Currency},
+		{`null`, 0, ""},
+	}
+	for _, tt := range tests {
+		var got Money
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.in, err)
+			continue
+		}
+		if got.Cents != tt.cents || got.Currency != tt.currency {
+			t.Errorf("Unmarshal(%s) = %+v, want %d %q", tt.in, got, tt.cents, tt.currency)
+		}
+	}
+
+	var bad Money
+	if err := json.Unmarshal([]byte(`"abc"`), &bad); err == nil {
+		t.Errorf("Unmarshal of a non-numeric string succeeded")
+	}
+}
+
+func TestMoneyBSON(t *testing.T) {
+	type doc struct {
+		Amount Money `bson:"amount"`
+	}
+
+	for _, m := range []Money{NewMoney(9950), NewMoney(-1225), {Cents: 300, Currency: "USD"}} {
+		data, err := bson.Marshal(doc{m})
+		if err != nil {
+			t.Fatalf("Marshal(%+v): %v", m, err)
+		}
+		var got doc
+		if err := bson.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if got.Amount != m {
+			t.Errorf("round trip of %+v = %+v", m, got.Amount)
+		}
+	}
+
+	// Documents written before Money held plain numbers or strings in major
+	// units.
+	tests := []struct {
+		name   string
+		legacy interface{}
+		cents  int64
+	}{
+		{"int32", int32(150), 15000},
+		{"int64", int64(150), 15000},
+		{"double", 99.5, 9950},
+		{"negative double", -12.25, -1225},
+		{"string", "1,200", 120000},
+		{"string with cents", "99.50", 9950},
+	}
+	for _, tt := range tests {
+		data, err := bson.Marshal(bson.M{"amount": tt.legacy})
+		if err != nil {
+			t.Fatalf("%s: Marshal: %v", tt.name, err)
+		}
+		var got doc
+		if err := bson.Unmarshal(data, &got); err != nil {
+			t.Errorf("%s: Unmarshal: %v", tt.name, err)
+			continue
+		}
+		if got.Amount != NewMoney(tt.cents) {
+			t.Errorf("%s: decoded %+v, want %d cents", tt.name, got.Amount, tt.cents)
+		}
+	}
+
+	data, _ := bson.Marshal(bson.M{"amount": "n/a"})
+	var got doc
+	if err := bson.Unmarshal(data, &got); err == nil {
+		t.Errorf("Unmarshal of a non-numeric string succeeded")
+	}
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type MenuItem struct {
+	MenuItemId string    `json:"menuItemId" bson:"menuItemId"`
+	Name       string    `json:"name" bson:"name"`
+	Category   string    `json:"category,omitempty" bson:"category,omitempty"` // menu section, e.g. "Tacos"
+	Quantity   int       `json:"quantity" bson:"quantity"`
+	Price      Money     `json:"price" bson:"price"`
+	Cost       Money     `json:"cost" bson:"cost"`
+	Time       time.Time `json:"time" bson:"time"`
+}
+
+type SalesData struct {
+	ID            interface{} `bson:"_id,omitempty"`
+	Items         []MenuItem  `json:"items"`
+	PaymentMethod string      `json:"paymentMethod"`
+	Total         Money       `json:"total"`
+	RecordedAt    time.Time   `json:"recordedAt" bson:"recordedAt"`
+	Voided        *Void       `json:"voided,omitempty" bson:"voided,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Void marks a sale or expense as taken back. Voided records stay in the
+// database so they can be listed in the trash and restored, but they are
+// left out of listings and analytics.
+type Void struct {
+	VoidedAt time.Time `json:"voidedAt" bson:"voidedAt"`
+	VoidedBy string    `json:"voidedBy" bson:"voidedBy"`
+	Reason   string    `json:"reason" bson:"reason"`
+}
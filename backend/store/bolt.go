@@ -0,0 +1,718 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"tacohut/models"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BoltStore keeps everything in a single bbolt file so a shop can run
+// without any external database. Documents are stored BSON-encoded with
+// the same field names the Mongo backend uses; each Mongo collection maps
+// to a bucket of the same name.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+const (
+	salesBucket     = "dailysales"
+	expensesBucket  = "dailyExpense"
+	dailyBucket     = "dailyAnalysis"
+	analyticsBucket = "analytics"
+	anomaliesBucket = "anomalies"
+	settingsBucket  = "settings"
+)
+
+// OpenBolt opens (or creates) the database file at path.
+func OpenBolt(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		buckets := []string{salesBucket, expensesBucket, dailyBucket, analyticsBucket, anomaliesBucket, settingsBucket, migrationsBucket}
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return fmt.Errorf("error creating bucket %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	fmt.Println("Opened embedded database", path)
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Sales() SalesStore             { return boltSales{s.db} }
+func (s *BoltStore) Expenses() ExpenseStore        { return boltExpenses{s.db} }
+func (s *BoltStore) Periods() PeriodAnalyticsStore { return boltPeriods{s.db} }
+func (s *BoltStore) Daily() DailyAnalysisStore     { return boltDaily{s.db} }
+func (s *BoltStore) Anomalies() AnomalyStore       { return boltAnomalies{s.db} }
+
+// setting is how Settings values are stored, in Mongo and bbolt alike.
+type setting struct {
+	Name  string `bson:"_id"`
+	Value string `bson:"value"`
+}
+
+func (s *BoltStore) GetSetting(ctx context.Context, name string) (string, error) {
+	var stored setting
+	err := view(ctx, s.db, func(tx *bolt.Tx) error {
+		return getDoc(tx, settingsBucket, []byte(name), &stored)
+	})
+	return stored.Value, err
+}
+
+func (s *BoltStore) PutSetting(ctx context.Context, name, value string) error {
+	return update(ctx, s.db, func(tx *bolt.Tx) error {
+		return putDoc(tx, settingsBucket, []byte(name), setting{Name: name, Value: value})
+	})
+}
+
+func (s *BoltStore) Close(ctx context.Context) error {
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("error closing database file: %w", err)
+	}
+	fmt.Println("Database file closed")
+	return nil
+}
+
+type boltTxKey struct{}
+
+// RunInTransaction runs fn inside a single read-write bbolt transaction.
+// Store calls made with the ctx passed to fn join that transaction.
+func (s *BoltStore) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(boltTxKey{}).(*bolt.Tx); ok {
+		return fn(ctx)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(context.WithValue(ctx, boltTxKey{}, tx))
+	})
+}
+
+// update runs fn in the transaction carried by ctx, or a new one.
+func update(ctx context.Context, db *bolt.DB, fn func(tx *bolt.Tx) error) error {
+	if tx, ok := ctx.Value(boltTxKey{}).(*bolt.Tx); ok {
+		return fn(tx)
+	}
+	return db.Update(fn)
+}
+
+// view is update for read-only work.
+func view(ctx context.Context, db *bolt.DB, fn func(tx *bolt.Tx) error) error {
+	if tx, ok := ctx.Value(boltTxKey{}).(*bolt.Tx); ok {
+		return fn(tx)
+	}
+	return db.View(fn)
+}
+
+// putDoc BSON-encodes doc under key in bucket.
+func putDoc(tx *bolt.Tx, bucket string, key []byte, doc interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("error encoding %s document: %w", bucket, err)
+	}
+	return tx.Bucket([]byte(bucket)).Put(key, data)
+}
+
+// getDoc decodes the document under key, returning ErrNotFound if absent.
+func getDoc(tx *bolt.Tx, bucket string, key []byte, doc interface{}) error {
+	data := tx.Bucket([]byte(bucket)).Get(key)
+	if data == nil {
+		return ErrNotFound
+	}
+	return bson.Unmarshal(data, doc)
+}
+
+// deleteDoc removes key from bucket, returning ErrNotFound if absent.
+func deleteDoc(tx *bolt.Tx, bucket string, key []byte) error {
+	b := tx.Bucket([]byte(bucket))
+	if b.Get(key) == nil {
+		return ErrNotFound
+	}
+	return b.Delete(key)
+}
+
+// eachDoc calls fn with every raw document in bucket, in key order.
+func eachDoc(tx *bolt.Tx, bucket string, fn func(data []byte) error) error {
+	return tx.Bucket([]byte(bucket)).ForEach(func(_, data []byte) error {
+		return fn(data)
+	})
+}
+
+// methodAmount is what methodTotalsBefore needs from a sale or expense.
+type methodAmount struct {
+	method string
+	cents  int64
+	at     time.Time
+	voided bool
+}
+
+// methodTotalsBefore sums the amounts in bucket before t per payment method
+// in one pass, without holding the decoded records.
+func methodTotalsBefore(ctx context.Context, db *bolt.DB, bucket string, t time.Time, decode func(data []byte) (methodAmount, error)) (map[string]int64, error) {
+	totals := make(map[string]int64)
+	err := view(ctx, db, func(tx *bolt.Tx) error {
+		return eachDoc(tx, bucket, func(data []byte) error {
+			record, err := decode(data)
+			if err != nil {
+				return err
+			}
+			if !record.voided && record.at.Before(t) {
+				totals[record.method] += record.cents
+			}
+			return nil
+		})
+	})
+	return totals, err
+}
+
+// dateKey is the bucket key for documents identified by a point in time.
+// RFC 3339 in UTC sorts lexically in time order.
+func dateKey(t time.Time) []byte {
+	return []byte(t.UTC().Format(time.RFC3339Nano))
+}
+
+type boltSales struct {
+	db *bolt.DB
+}
+
+func (b boltSales) InsertSale(ctx context.Context, sale models.SalesData) (primitive.ObjectID, error) {
+	id := primitive.NewObjectID()
+	sale.ID = id
+	err := update(ctx, b.db, func(tx *bolt.Tx) error {
+		return putDoc(tx, salesBucket, id[:], sale)
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return id, nil
+}
+
+func (b boltSales) FindSale(ctx context.Context, id primitive.ObjectID) (models.SalesData, error) {
+	var sale models.SalesData
+	err := view(ctx, b.db, func(tx *bolt.Tx) error {
+		return getDoc(tx, salesBucket, id[:], &sale)
+	})
+	return sale, err
+}
+
+func (b boltSales) ListSales(ctx context.Context, q SalesQuery) (SalesPage, error) {
+	all, err := b.list(ctx, false)
+	if err != nil {
+		return SalesPage{}, err
+	}
+	return pageSales(all, q), nil
+}
+
+func (b boltSales) list(ctx context.Context, voided bool) ([]models.SalesData, error) {
+	var salesItems []models.SalesData
+	err := view(ctx, b.db, func(tx *bolt.Tx) error {
+		return eachDoc(tx, salesBucket, func(data []byte) error {
+			var sale models.SalesData
+			if err := bson.Unmarshal(data, &sale); err != nil {
+				return err
+			}
+			if (sale.Voided != nil) == voided {
+				salesItems = append(salesItems, sale)
+			}
+			return nil
+		})
+	})
+	sort.SliceStable(salesItems, func(i, j int) bool {
+		return salesItems[i].RecordedAt.After(salesItems[j].RecordedAt)
+	})
+	return salesItems, err
+}
+
+func (b boltSales) SalesBetween(ctx context.Context, from, to time.Time) ([]models.SalesData, error) {
+	all, err := b.list(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var salesItems []models.SalesData
+	for _, sale := range all {
+		if !sale.RecordedAt.Before(from) && !sale.RecordedAt.After(to) {
+			salesItems = append(salesItems, sale)
+		}
+	}
+	sort.SliceStable(salesItems, func(i, j int) bool {
+		return salesItems[i].RecordedAt.Before(salesItems[j].RecordedAt)
+	})
+	return salesItems, nil
+}
+
+func (b boltSales) SalesByHour(ctx context.Context, q HourQuery) ([]HourTotal, error) {
+	sales, err := b.SalesBetween(ctx, q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+	return hourTotals(sales, q), nil
+}
+
+func (b boltSales) SalesByMethodBefore(ctx context.Context, t time.Time) (map[string]int64, error) {
+	return methodTotalsBefore(ctx, b.db, salesBucket, t, func(data []byte) (methodAmount, error) {
+		var sale models.SalesData
+		err := bson.Unmarshal(data, &sale)
+		return methodAmount{sale.PaymentMethod, sale.Total.Cents, sale.RecordedAt, sale.Voided != nil}, err
+	})
+}
+
+func (b boltSales) ListVoidedSales(ctx context.Context) ([]models.SalesData, error) {
+	salesItems, err := b.list(ctx, true)
+	sort.SliceStable(salesItems, func(i, j int) bool {
+		return salesItems[i].Voided.VoidedAt.After(salesItems[j].Voided.VoidedAt)
+	})
+	return salesItems, err
+}
+
+func (b boltSales) ReplaceSale(ctx context.Context, id primitive.ObjectID, sale models.SalesData) error {
+	return update(ctx, b.db, func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(salesBucket)).Get(id[:]) == nil {
+			return ErrNotFound
+		}
+		sale.ID = id
+		return putDoc(tx, salesBucket, id[:], sale)
+	})
+}
+
+func (b boltSales) SetSaleVoid(ctx context.Context, id primitive.ObjectID, void *models.Void) error {
+	return update(ctx, b.db, func(tx *bolt.Tx) error {
+		var sale models.SalesData
+		if err := getDoc(tx, salesBucket, id[:], &sale); err != nil {
+			return err
+		}
+		sale.Voided = void
+		return putDoc(tx, salesBucket, id[:], sale)
+	})
+}
+
+type boltExpenses struct {
+	db *bolt.DB
+}
+
+func (b boltExpenses) InsertExpense(ctx context.Context, expense models.Expenses) (primitive.ObjectID, error) {
+	id := primitive.NewObjectID()
+	doc := models.ExpensesFetched{
+		ID:            id,
+		Amount:        expense.Amount,
+		Category:      expense.Category,
+		Description:   expense.Description,
+		PaymentMethod: expense.PaymentMethod,
+		TimeAdded:     expense.TimeAdded,
+	}
+	err := update(ctx, b.db, func(tx *bolt.Tx) error {
+		return putDoc(tx, expensesBucket, id[:], doc)
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return id, nil
+}
+
+func (b boltExpenses) FindExpense(ctx context.Context, id primitive.ObjectID) (models.ExpensesFetched, error) {
+	var expense models.ExpensesFetched
+	err := view(ctx, b.db, func(tx *bolt.Tx) error {
+		return getDoc(tx, expensesBucket, id[:], &expense)
+	})
+	return expense, err
+}
+
+func (b boltExpenses) ListExpenses(ctx context.Context, q ExpenseQuery) (ExpensePage, error) {
+	all, err := b.list(ctx, false)
+	if err != nil {
+		return ExpensePage{}, err
+	}
+	return pageExpenses(all, q), nil
+}
+
+func (b boltExpenses) list(ctx context.Context, voided bool) ([]models.ExpensesFetched, error) {
+	var expenses []models.ExpensesFetched
+	err := view(ctx, b.db, func(tx *bolt.Tx) error {
+		return eachDoc(tx, expensesBucket, func(data []byte) error {
+			var expense models.ExpensesFetched
+			if err := bson.Unmarshal(data, &expense); err != nil {
+				return err
+			}
+			if (expense.Voided != nil) == voided {
+				expenses = append(expenses, expense)
+			}
+			return nil
+		})
+	})
+	sort.SliceStable(expenses, func(i, j int) bool {
+		return expenses[i].TimeAdded.After(expenses[j].TimeAdded)
+	})
+	return expenses, err
+}
+
+func (b boltExpenses) ExpensesBetween(ctx context.Context, from, to time.Time) ([]models.ExpensesFetched, error) {
+	all, err := b.list(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var expenses []models.ExpensesFetched
+	for _, expense := range all {
+		if !expense.TimeAdded.Before(from) && !expense.TimeAdded.After(to) {
+			expenses = append(expenses, expense)
+		}
+	}
+	sort.SliceStable(expenses, func(i, j int) bool {
+		return expenses[i].TimeAdded.Before(expenses[j].TimeAdded)
+	})
+	return expenses, nil
+}
+
+func (b boltExpenses) ExpensesByMethodBefore(ctx context.Context, t time.Time) (map[string]int64, error) {
+	return methodTotalsBefore(ctx, b.db, expensesBucket, t, func(data []byte) (methodAmount, error) {
+		var expense models.ExpensesFetched
+		err := bson.Unmarshal(data, &expense)
+		return methodAmount{expense.PaymentMethod, expense.Amount.Cents, expense.TimeAdded, expense.Voided != nil}, err
+	})
+}
+
+func (b boltExpenses) ListVoidedExpenses(ctx context.Context) ([]models.ExpensesFetched, error) {
+	expenses, err := b.list(ctx, true)
+	sort.SliceStable(expenses, func(i, j int) bool {
+		return expenses[i].Voided.VoidedAt.After(expenses[j].Voided.VoidedAt)
+	})
+	return expenses, err
+}
+
+func (b boltExpenses) ReplaceExpense(ctx context.Context, id primitive.ObjectID, expense models.ExpensesFetched) error {
+	return update(ctx, b.db, func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(expensesBucket)).Get(id[:]) == nil {
+			return ErrNotFound
+		}
+		expense.ID = id
+		return putDoc(tx, expensesBucket, id[:], expense)
+	})
+}
+
+func (b boltExpenses) SetExpenseVoid(ctx context.Context, id primitive.ObjectID, void *models.Void) error {
+	return update(ctx, b.db, func(tx *bolt.Tx) error {
+		var expense models.ExpensesFetched
+		if err := getDoc(tx, expensesBucket, id[:], &expense); err != nil {
+			return err
+		}
+		expense.Voided = void
+		return putDoc(tx, expensesBucket, id[:], expense)
+	})
+}
+
+type boltPeriods struct {
+	db *bolt.DB
+}
+
+// periodKey keys a rollup in the analytics bucket by period and then by
+// start, so each period's rollups sit together in time order.
+func periodKey(period string, startDate, endDate time.Time) []byte {
+	key := append(periodPrefix(period), dateKey(startDate)...)
+	return append(append(key, '|'), dateKey(endDate)...)
+}
+
+func periodPrefix(period string) []byte {
+	return []byte(period + "|")
+}
+
+func (b boltPeriods) FindPeriod(ctx context.Context, period string, startDate, endDate time.Time) (models.AnalyticsSummary, error) {
+	var analytics models.AnalyticsSummary
+	if err := validPeriod(period); err != nil {
+		return analytics, err
+	}
+
+	err := view(ctx, b.db, func(tx *bolt.Tx) error {
+		return getDoc(tx, analyticsBucket, periodKey(period, startDate, endDate), &analytics)
+	})
+	return analytics, err
+}
+
+func (b boltPeriods) ListPeriods(ctx context.Context, period string) ([]models.AnalyticsSummary, error) {
+	if err := validPeriod(period); err != nil {
+		return nil, err
+	}
+
+	var summaries []models.AnalyticsSummary
+	err := view(ctx, b.db, func(tx *bolt.Tx) error {
+		prefix := periodPrefix(period)
+		c := tx.Bucket([]byte(analyticsBucket)).Cursor()
+		for k, data := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, data = c.Next() {
+			var summary models.AnalyticsSummary
+			if err := bson.Unmarshal(data, &summary); err != nil {
+				return err
+			}
+			summaries = append(summaries, summary)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s analytics: %w", period, err)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].StartDate.After(summaries[j].StartDate)
+	})
+	return summaries, nil
+}
+
+func (b boltPeriods) PeriodsBetween(ctx context.Context, period string, from, to time.Time) ([]models.AnalyticsSummary, error) {
+	all, err := b.ListPeriods(ctx, period)
+	if err != nil {
+		return nil, err
+	}
+	return summariesBetween(all, from, to), nil
+}
+
+func (b boltPeriods) IncrementPeriod(ctx context.Context, period string, startDate, endDate time.Time, delta models.AnalyticsDelta) error {
+	if err := validPeriod(period); err != nil {
+		return err
+	}
+
+	key := periodKey(period, startDate, endDate)
+	return update(ctx, b.db, func(tx *bolt.Tx) error {
+		var summary models.AnalyticsSummary
+		err := getDoc(tx, analyticsBucket, key, &summary)
+		if err == ErrNotFound {
+			summary = models.AnalyticsSummary{
+				ID:        primitive.NewObjectID(),
+				Period:    period,
+				StartDate: startDate,
+				EndDate:   endDate,
+			}
+		} else if err != nil {
+			return fmt.Errorf("error finding %s analytics: %w", period, err)
+		}
+
+		if summary.ItemsSold == nil {
+			summary.ItemsSold = make(map[string]int)
+		}
+		if summary.PaymentMethods == nil {
+			summary.PaymentMethods = make(map[string]models.Money)
+		}
+		applySummaryDelta(&summary, delta)
+
+		return putDoc(tx, analyticsBucket, key, summary)
+	})
+}
+
+func (b boltPeriods) DeletePeriod(ctx context.Context, period string, startDate, endDate time.Time) error {
+	if err := validPeriod(period); err != nil {
+		return err
+	}
+
+	return update(ctx, b.db, func(tx *bolt.Tx) error {
+		return deleteDoc(tx, analyticsBucket, periodKey(period, startDate, endDate))
+	})
+}
+
+func (b boltPeriods) ClearPeriods(ctx context.Context, period string) error {
+	if err := validPeriod(period); err != nil {
+		return err
+	}
+
+	return update(ctx, b.db, func(tx *bolt.Tx) error {
+		prefix := periodPrefix(period)
+		c := tx.Bucket([]byte(analyticsBucket)).Cursor()
+		// Deleting through the cursor moves it to the next key.
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type boltDaily struct {
+	db *bolt.DB
+}
+
+func (b boltDaily) FindDay(ctx context.Context, date time.Time) (models.DailyData, error) {
+	var day models.DailyData
+	err := view(ctx, b.db, func(tx *bolt.Tx) error {
+		return getDoc(tx, dailyBucket, dateKey(date), &day)
+	})
+	return day, err
+}
+
+func (b boltDaily) ListDays(ctx context.Context) ([]models.DailyData, error) {
+	var days []models.DailyData
+	err := view(ctx, b.db, func(tx *bolt.Tx) error {
+		return eachDoc(tx, dailyBucket, func(data []byte) error {
+			var day models.DailyData
+			if err := bson.Unmarshal(data, &day); err != nil {
+				return err
+			}
+			days = append(days, day)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching analytics: %w", err)
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date.After(days[j].Date)
+	})
+	return days, nil
+}
+
+func (b boltDaily) DaysBetween(ctx context.Context, from, to time.Time) ([]models.DailyData, error) {
+	var days []models.DailyData
+	err := view(ctx, b.db, func(tx *bolt.Tx) error {
+		return eachDoc(tx, dailyBucket, func(data []byte) error {
+			var day models.DailyData
+			if err := bson.Unmarshal(data, &day); err != nil {
+				return err
+			}
+			if !day.Date.Before(from) && !day.Date.After(to) {
+				days = append(days, day)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching analytics: %w", err)
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date.Before(days[j].Date)
+	})
+	return days, nil
+}
+
+func (b boltDaily) IncrementDay(ctx context.Context, date time.Time, delta models.AnalyticsDelta) error {
+	key := dateKey(date)
+	return update(ctx, b.db, func(tx *bolt.Tx) error {
+		var day models.DailyData
+		err := getDoc(tx, dailyBucket, key, &day)
+		if err == ErrNotFound {
+			day = models.DailyData{
+				ID:   primitive.NewObjectID(),
+				Date: date,
+			}
+		} else if err != nil {
+			return fmt.Errorf("error finding daily data: %w", err)
+		}
+
+		if day.ItemsSold == nil {
+			day.ItemsSold = make(map[string]int)
+		}
+		if day.PaymentSummary == nil {
+			day.PaymentSummary = make(map[string]int)
+		}
+		if day.ExpenseCategory == nil {
+			day.ExpenseCategory = make(map[string]models.Money)
+		}
+		applyDayDelta(&day, delta)
+
+		return putDoc(tx, dailyBucket, key, day)
+	})
+}
+
+func (b boltDaily) DeleteDay(ctx context.Context, id primitive.ObjectID) error {
+	return update(ctx, b.db, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(dailyBucket))
+		c := bucket.Cursor()
+		for k, data := c.First(); k != nil; k, data = c.Next() {
+			var day models.DailyData
+			if err := bson.Unmarshal(data, &day); err != nil {
+				return err
+			}
+			if day.ID == id {
+				return bucket.Delete(k)
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+func (b boltDaily) DeleteDayByDate(ctx context.Context, date time.Time) error {
+	return update(ctx, b.db, func(tx *bolt.Tx) error {
+		return deleteDoc(tx, dailyBucket, dateKey(date))
+	})
+}
+
+// boltAnomalies keys anomalies by their Key.
+type boltAnomalies struct {
+	db *bolt.DB
+}
+
+func (b boltAnomalies) UpsertAnomaly(ctx context.Context, a models.Anomaly) error {
+	return update(ctx, b.db, func(tx *bolt.Tx) error {
+		var existing models.Anomaly
+		err := getDoc(tx, anomaliesBucket, []byte(a.Key), &existing)
+		switch {
+		case err == nil:
+			a.ID, a.DetectedAt = existing.ID, existing.DetectedAt
+			a.Acknowledged, a.AcknowledgedAt = existing.Acknowledged, existing.AcknowledgedAt
+		case errors.Is(err, ErrNotFound):
+			a.ID = primitive.NewObjectID()
+		default:
+			return err
+		}
+		return putDoc(tx, anomaliesBucket, []byte(a.Key), a)
+	})
+}
+
+func (b boltAnomalies) ResolveAnomaly(ctx context.Context, key string) error {
+	return update(ctx, b.db, func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(anomaliesBucket)).Delete([]byte(key))
+	})
+}
+
+func (b boltAnomalies) ListAnomalies(ctx context.Context, q AnomalyQuery) ([]models.Anomaly, error) {
+	all, err := b.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return listAnomalies(all, q), nil
+}
+
+func (b boltAnomalies) list(ctx context.Context) ([]models.Anomaly, error) {
+	var all []models.Anomaly
+	err := view(ctx, b.db, func(tx *bolt.Tx) error {
+		return eachDoc(tx, anomaliesBucket, func(data []byte) error {
+			var a models.Anomaly
+			if err := bson.Unmarshal(data, &a); err != nil {
+				return err
+			}
+			all = append(all, a)
+			return nil
+		})
+	})
+	return all, err
+}
+
+func (b boltAnomalies) AcknowledgeAnomaly(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	return update(ctx, b.db, func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(anomaliesBucket)).Cursor()
+		for k, data := c.First(); k != nil; k, data = c.Next() {
+			var a models.Anomaly
+			if err := bson.Unmarshal(data, &a); err != nil {
+				return err
+			}
+			if a.ID == id {
+				a.Acknowledged, a.AcknowledgedAt = true, &at
+				return putDoc(tx, anomaliesBucket, k, a)
+			}
+		}
+		return ErrNotFound
+	})
+}
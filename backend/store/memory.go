@@ -0,0 +1,584 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"tacohut/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps everything in process memory. It is meant for local
+// development and end-to-end tests; nothing survives a restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	sales     []models.SalesData
+	expenses  []models.ExpensesFetched
+	periods   map[string][]models.AnalyticsSummary
+	days      []models.DailyData
+	anomalies []models.Anomaly
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{periods: make(map[string][]models.AnalyticsSummary)}
+}
+
+func (s *MemoryStore) Sales() SalesStore               { return memorySales{s} }
+func (s *MemoryStore) Expenses() ExpenseStore          { return memoryExpenses{s} }
+func (s *MemoryStore) Periods() PeriodAnalyticsStore   { return memoryPeriods{s} }
+func (s *MemoryStore) Daily() DailyAnalysisStore       { return memoryDaily{s} }
+func (s *MemoryStore) Anomalies() AnomalyStore         { return memoryAnomalies{s} }
+func (s *MemoryStore) Close(ctx context.Context) error { return nil }
+
+type memoryTxKey struct{}
+
+// lock takes the store mutex unless ctx belongs to a transaction on this
+// store, which already holds it. Callers defer the returned unlock.
+func (s *MemoryStore) lock(ctx context.Context) func() {
+	if ctx.Value(memoryTxKey{}) == s {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// RunInTransaction holds the store lock for the whole of fn and puts the
+// previous state back if fn fails.
+func (s *MemoryStore) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(memoryTxKey{}) == s {
+		return fn(ctx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sales := append([]models.SalesData(nil), s.sales...)
+	expenses := append([]models.ExpensesFetched(nil), s.expenses...)
+	periods := make(map[string][]models.AnalyticsSummary, len(s.periods))
+	for period, summaries := range s.periods {
+		for _, summary := range summaries {
+			periods[period] = append(periods[period], copySummary(summary))
+		}
+	}
+	days := make([]models.DailyData, 0, len(s.days))
+	for _, day := range s.days {
+		days = append(days, copyDay(day))
+	}
+	anomalies := append([]models.Anomaly(nil), s.anomalies...)
+
+	if err := fn(context.WithValue(ctx, memoryTxKey{}, s)); err != nil {
+		s.sales, s.expenses, s.periods, s.days, s.anomalies = sales, expenses, periods, days, anomalies
+		return err
+	}
+	return nil
+}
+
+type memorySales struct {
+	s *MemoryStore
+}
+
+func (m memorySales) InsertSale(ctx context.Context, sale models.SalesData) (primitive.ObjectID, error) {
+	defer m.s.lock(ctx)()
+
+	id := primitive.NewObjectID()
+	sale.ID = id
+	sale.Items = append([]models.MenuItem(nil), sale.Items...)
+	m.s.sales = append(m.s.sales, sale)
+	return id, nil
+}
+
+func (m memorySales) FindSale(ctx context.Context, id primitive.ObjectID) (models.SalesData, error) {
+	defer m.s.lock(ctx)()
+
+	for _, sale := range m.s.sales {
+		if sale.ID == id {
+			return sale, nil
+		}
+	}
+	return models.SalesData{}, ErrNotFound
+}
+
+func (m memorySales) ListSales(ctx context.Context, q SalesQuery) (SalesPage, error) {
+	defer m.s.lock(ctx)()
+
+	return pageSales(m.s.sales, q), nil
+}
+
+func (m memorySales) SalesBetween(ctx context.Context, from, to time.Time) ([]models.SalesData, error) {
+	defer m.s.lock(ctx)()
+
+	var salesItems []models.SalesData
+	for _, sale := range m.s.sales {
+		if sale.Voided == nil && !sale.RecordedAt.Before(from) && !sale.RecordedAt.After(to) {
+			salesItems = append(salesItems, sale)
+		}
+	}
+	sort.SliceStable(salesItems, func(i, j int) bool {
+		return salesItems[i].RecordedAt.Before(salesItems[j].RecordedAt)
+	})
+	return salesItems, nil
+}
+
+func (m memorySales) SalesByHour(ctx context.Context, q HourQuery) ([]HourTotal, error) {
+	sales, err := m.SalesBetween(ctx, q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+	return hourTotals(sales, q), nil
+}
+
+func (m memorySales) SalesByMethodBefore(ctx context.Context, t time.Time) (map[string]int64, error) {
+	defer m.s.lock(ctx)()
+
+	totals := make(map[string]int64)
+	for _, sale := range m.s.sales {
+		if sale.Voided == nil && sale.RecordedAt.Before(t) {
+			totals[sale.PaymentMethod] += sale.Total.Cents
+		}
+	}
+	return totals, nil
+}
+
+func (m memorySales) ListVoidedSales(ctx context.Context) ([]models.SalesData, error) {
+	defer m.s.lock(ctx)()
+
+	var salesItems []models.SalesData
+	for _, sale := range m.s.sales {
+		if sale.Voided != nil {
+			salesItems = append(salesItems, sale)
+		}
+	}
+	sort.SliceStable(salesItems, func(i, j int) bool {
+		return salesItems[i].Voided.VoidedAt.After(salesItems[j].Voided.VoidedAt)
+	})
+	return salesItems, nil
+}
+
+func (m memorySales) ReplaceSale(ctx context.Context, id primitive.ObjectID, sale models.SalesData) error {
+	defer m.s.lock(ctx)()
+
+	for i, stored := range m.s.sales {
+		if stored.ID == id {
+			sale.ID = id
+			sale.Items = append([]models.MenuItem(nil), sale.Items...)
+			sale.Voided = copyVoid(sale.Voided)
+			m.s.sales[i] = sale
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m memorySales) SetSaleVoid(ctx context.Context, id primitive.ObjectID, void *models.Void) error {
+	defer m.s.lock(ctx)()
+
+	for i, sale := range m.s.sales {
+		if sale.ID == id {
+			m.s.sales[i].Voided = copyVoid(void)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+type memoryExpenses struct {
+	s *MemoryStore
+}
+
+func (m memoryExpenses) InsertExpense(ctx context.Context, expense models.Expenses) (primitive.ObjectID, error) {
+	defer m.s.lock(ctx)()
+
+	id := primitive.NewObjectID()
+	m.s.expenses = append(m.s.expenses, models.ExpensesFetched{
+		ID:            id,
+		Amount:        expense.Amount,
+		Category:      expense.Category,
+		Description:   expense.Description,
+		PaymentMethod: expense.PaymentMethod,
+		TimeAdded:     expense.TimeAdded,
+	})
+	return id, nil
+}
+
+func (m memoryExpenses) FindExpense(ctx context.Context, id primitive.ObjectID) (models.ExpensesFetched, error) {
+	defer m.s.lock(ctx)()
+
+	for _, expense := range m.s.expenses {
+		if expense.ID == id {
+			return expense, nil
+		}
+	}
+	return models.ExpensesFetched{}, ErrNotFound
+}
+
+func (m memoryExpenses) ListExpenses(ctx context.Context, q ExpenseQuery) (ExpensePage, error) {
+	defer m.s.lock(ctx)()
+
+	return pageExpenses(m.s.expenses, q), nil
+}
+
+func (m memoryExpenses) ExpensesBetween(ctx context.Context, from, to time.Time) ([]models.ExpensesFetched, error) {
+	defer m.s.lock(ctx)()
+
+	var expenses []models.ExpensesFetched
+	for _, expense := range m.s.expenses {
+		if expense.Voided == nil && !expense.TimeAdded.Before(from) && !expense.TimeAdded.After(to) {
+			expenses = append(expenses, expense)
+		}
+	}
+	sort.SliceStable(expenses, func(i, j int) bool {
+		return expenses[i].TimeAdded.Before(expenses[j].TimeAdded)
+	})
+	return expenses, nil
+}
+
+func (m memoryExpenses) ExpensesByMethodBefore(ctx context.Context, t time.Time) (map[string]int64, error) {
+	defer m.s.lock(ctx)()
+
+	totals := make(map[string]int64)
+	for _, expense := range m.s.expenses {
+		if expense.Voided == nil && expense.TimeAdded.Before(t) {
+			totals[expense.PaymentMethod] += expense.Amount.Cents
+		}
+	}
+	return totals, nil
+}
+
+func (m memoryExpenses) ListVoidedExpenses(ctx context.Context) ([]models.ExpensesFetched, error) {
+	defer m.s.lock(ctx)()
+
+	var expenses []models.ExpensesFetched
+	for _, expense := range m.s.expenses {
+		if expense.Voided != nil {
+			expenses = append(expenses, expense)
+		}
+	}
+	sort.SliceStable(expenses, func(i, j int) bool {
+		return expenses[i].Voided.VoidedAt.After(expenses[j].Voided.VoidedAt)
+	})
+	return expenses, nil
+}
+
+func (m memoryExpenses) ReplaceExpense(ctx context.Context, id primitive.ObjectID, expense models.ExpensesFetched) error {
+	defer m.s.lock(ctx)()
+
+	for i, stored := range m.s.expenses {
+		if stored.ID == id {
+			expense.ID = id
+			expense.Voided = copyVoid(expense.Voided)
+			m.s.expenses[i] = expense
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m memoryExpenses) SetExpenseVoid(ctx context.Context, id primitive.ObjectID, void *models.Void) error {
+	defer m.s.lock(ctx)()
+
+	for i, expense := range m.s.expenses {
+		if expense.ID == id {
+			m.s.expenses[i].Voided = copyVoid(void)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// copyVoid keeps stored records from sharing a Void with the caller.
+func copyVoid(void *models.Void) *models.Void {
+	if void == nil {
+		return nil
+	}
+	v := *void
+	return &v
+}
+
+type memoryPeriods struct {
+	s *MemoryStore
+}
+
+func (m memoryPeriods) FindPeriod(ctx context.Context, period string, startDate, endDate time.Time) (models.AnalyticsSummary, error) {
+	if err := validPeriod(period); err != nil {
+		return models.AnalyticsSummary{}, err
+	}
+
+	defer m.s.lock(ctx)()
+
+	for _, summary := range m.s.periods[period] {
+		if summary.StartDate.Equal(startDate) && summary.EndDate.Equal(endDate) {
+			return copySummary(summary), nil
+		}
+	}
+	return models.AnalyticsSummary{}, ErrNotFound
+}
+
+func (m memoryPeriods) ListPeriods(ctx context.Context, period string) ([]models.AnalyticsSummary, error) {
+	if err := validPeriod(period); err != nil {
+		return nil, err
+	}
+
+	defer m.s.lock(ctx)()
+
+	summaries := make([]models.AnalyticsSummary, 0, len(m.s.periods[period]))
+	for _, summary := range m.s.periods[period] {
+		summaries = append(summaries, copySummary(summary))
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].StartDate.After(summaries[j].StartDate)
+	})
+	return summaries, nil
+}
+
+func (m memoryPeriods) PeriodsBetween(ctx context.Context, period string, from, to time.Time) ([]models.AnalyticsSummary, error) {
+	all, err := m.ListPeriods(ctx, period)
+	if err != nil {
+		return nil, err
+	}
+	return summariesBetween(all, from, to), nil
+}
+
+func (m memoryPeriods) IncrementPeriod(ctx context.Context, period string, startDate, endDate time.Time, delta models.AnalyticsDelta) error {
+	if err := validPeriod(period); err != nil {
+		return err
+	}
+
+	defer m.s.lock(ctx)()
+
+	summaries := m.s.periods[period]
+	for i := range summaries {
+		if summaries[i].StartDate.Equal(startDate) && summaries[i].EndDate.Equal(endDate) {
+			applySummaryDelta(&summaries[i], delta)
+			return nil
+		}
+	}
+
+	summary := models.AnalyticsSummary{
+		ID:             primitive.NewObjectID(),
+		Period:         period,
+		StartDate:      startDate,
+		EndDate:        endDate,
+		ItemsSold:      make(map[string]int),
+		PaymentMethods: make(map[string]models.Money),
+	}
+	applySummaryDelta(&summary, delta)
+	m.s.periods[period] = append(summaries, summary)
+	return nil
+}
+
+func (m memoryPeriods) DeletePeriod(ctx context.Context, period string, startDate, endDate time.Time) error {
+	if err := validPeriod(period); err != nil {
+		return err
+	}
+
+	defer m.s.lock(ctx)()
+
+	summaries := m.s.periods[period]
+	for i := range summaries {
+		if summaries[i].StartDate.Equal(startDate) && summaries[i].EndDate.Equal(endDate) {
+			m.s.periods[period] = append(summaries[:i], summaries[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m memoryPeriods) ClearPeriods(ctx context.Context, period string) error {
+	if err := validPeriod(period); err != nil {
+		return err
+	}
+
+	defer m.s.lock(ctx)()
+
+	delete(m.s.periods, period)
+	return nil
+}
+
+func applySummaryDelta(summary *models.AnalyticsSummary, delta models.AnalyticsDelta) {
+	addCounts(summary.ItemsSold, delta.ItemsSold)
+	if summary.Items == nil {
+		// Rollups written before per-item stats have none yet.
+		summary.Items = make(map[string]models.ItemStats)
+	}
+	addItems(summary.Items, delta.Items)
+	addMoney(summary.PaymentMethods, delta.PaymentMethods)
+	if summary.ExpenseCategories == nil {
+		summary.ExpenseCategories = make(map[string]models.Money)
+	}
+	addMoney(summary.ExpenseCategories, delta.ExpenseCategories)
+	summary.TotalSales = summary.TotalSales.Add(models.NewMoney(delta.TotalSales))
+	summary.TotalExpenses = summary.TotalExpenses.Add(models.NewMoney(delta.TotalExpenses))
+	summary.CostOfGoods = summary.CostOfGoods.Add(models.NewMoney(delta.CostOfGoods))
+	summary.OperatingExpenses = summary.TotalExpenses.Sub(summary.CostOfGoods)
+	summary.GrossProfit = summary.TotalSales.Sub(summary.CostOfGoods)
+	summary.NetProfit = summary.TotalSales.Sub(summary.TotalExpenses)
+	summary.TransactionCount += delta.TransactionCount
+	summary.LastUpdated = time.Now()
+}
+
+func copySummary(summary models.AnalyticsSummary) models.AnalyticsSummary {
+	summary.ItemsSold = copyCounts(summary.ItemsSold)
+	summary.Items = copyCounts(summary.Items)
+	summary.ExpenseCategories = copyCounts(summary.ExpenseCategories)
+	summary.PaymentMethods = copyCounts(summary.PaymentMethods)
+	return summary
+}
+
+type memoryDaily struct {
+	s *MemoryStore
+}
+
+func (m memoryDaily) FindDay(ctx context.Context, date time.Time) (models.DailyData, error) {
+	defer m.s.lock(ctx)()
+
+	for _, day := range m.s.days {
+		if day.Date.Equal(date) {
+			return copyDay(day), nil
+		}
+	}
+	return models.DailyData{}, ErrNotFound
+}
+
+func (m memoryDaily) ListDays(ctx context.Context) ([]models.DailyData, error) {
+	defer m.s.lock(ctx)()
+
+	days := make([]models.DailyData, 0, len(m.s.days))
+	for _, day := range m.s.days {
+		days = append(days, copyDay(day))
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date.After(days[j].Date)
+	})
+	return days, nil
+}
+
+func (m memoryDaily) DaysBetween(ctx context.Context, from, to time.Time) ([]models.DailyData, error) {
+	defer m.s.lock(ctx)()
+
+	var days []models.DailyData
+	for _, day := range m.s.days {
+		if !day.Date.Before(from) && !day.Date.After(to) {
+			days = append(days, copyDay(day))
+		}
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date.Before(days[j].Date)
+	})
+	return days, nil
+}
+
+func (m memoryDaily) IncrementDay(ctx context.Context, date time.Time, delta models.AnalyticsDelta) error {
+	defer m.s.lock(ctx)()
+
+	for i := range m.s.days {
+		if m.s.days[i].Date.Equal(date) {
+			applyDayDelta(&m.s.days[i], delta)
+			return nil
+		}
+	}
+
+	day := models.DailyData{
+		ID:              primitive.NewObjectID(),
+		Date:            date,
+		ItemsSold:       make(map[string]int),
+		PaymentSummary:  make(map[string]int),
+		ExpenseCategory: make(map[string]models.Money),
+	}
+	applyDayDelta(&day, delta)
+	m.s.days = append(m.s.days, day)
+	return nil
+}
+
+func (m memoryDaily) DeleteDay(ctx context.Context, id primitive.ObjectID) error {
+	defer m.s.lock(ctx)()
+
+	for i, day := range m.s.days {
+		if day.ID == id {
+			m.s.days = append(m.s.days[:i], m.s.days[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m memoryDaily) DeleteDayByDate(ctx context.Context, date time.Time) error {
+	defer m.s.lock(ctx)()
+
+	for i, day := range m.s.days {
+		if day.Date.Equal(date) {
+			m.s.days = append(m.s.days[:i], m.s.days[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func applyDayDelta(day *models.DailyData, delta models.AnalyticsDelta) {
+	addCounts(day.ItemsSold, delta.ItemsSold)
+	addCounts(day.PaymentSummary, delta.PaymentMethods)
+	addMoney(day.ExpenseCategory, delta.ExpenseCategories)
+	day.TotalSales = day.TotalSales.Add(models.NewMoney(delta.TotalSales))
+	day.TotalExpenses = day.TotalExpenses.Add(models.NewMoney(delta.TotalExpenses))
+	day.NetProfit = day.TotalSales.Sub(day.TotalExpenses)
+	day.LastUpdated = time.Now()
+}
+
+func copyDay(day models.DailyData) models.DailyData {
+	day.ItemsSold = copyCounts(day.ItemsSold)
+	day.PaymentSummary = copyCounts(day.PaymentSummary)
+	day.ExpenseCategory = copyCounts(day.ExpenseCategory)
+	return day
+}
+
+type memoryAnomalies struct {
+	s *MemoryStore
+}
+
+func (m memoryAnomalies) UpsertAnomaly(ctx context.Context, a models.Anomaly) error {
+	defer m.s.lock(ctx)()
+
+	for i, existing := range m.s.anomalies {
+		if existing.Key == a.Key {
+			a.ID, a.DetectedAt = existing.ID, existing.DetectedAt
+			a.Acknowledged, a.AcknowledgedAt = existing.Acknowledged, existing.AcknowledgedAt
+			m.s.anomalies[i] = a
+			return nil
+		}
+	}
+	a.ID = primitive.NewObjectID()
+	m.s.anomalies = append(m.s.anomalies, a)
+	return nil
+}
+
+func (m memoryAnomalies) ResolveAnomaly(ctx context.Context, key string) error {
+	defer m.s.lock(ctx)()
+
+	for i, existing := range m.s.anomalies {
+		if existing.Key == key {
+			m.s.anomalies = append(m.s.anomalies[:i:i], m.s.anomalies[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m memoryAnomalies) ListAnomalies(ctx context.Context, q AnomalyQuery) ([]models.Anomaly, error) {
+	defer m.s.lock(ctx)()
+	return listAnomalies(m.s.anomalies, q), nil
+}
+
+func (m memoryAnomalies) AcknowledgeAnomaly(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	defer m.s.lock(ctx)()
+
+	for i := range m.s.anomalies {
+		if m.s.anomalies[i].ID == id {
+			m.s.anomalies[i].Acknowledged = true
+			m.s.anomalies[i].AcknowledgedAt = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
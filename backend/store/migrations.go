@@ -0,0 +1,864 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"tacohut/models"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is one schema change. Versions are applied in ascending order
+// and never renumbered once released; each backend that persists data
+// supplies its own implementation of every step.
+type Migration struct {
+	Version     int
+	Description string
+
+	mongo func(ctx context.Context, s *MongoStore) error
+	bolt  func(tx *bolt.Tx) error
+}
+
+// Migrations lists every schema migration in version order.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "store expense amounts as integers and backfill missing expense and sale fields",
+		mongo:       mongoBackfillExpensesAndSales,
+		bolt:        boltBackfillExpensesAndSales,
+	},
+	{
+		// Rollups are keyed by bucket in bbolt, so only Mongo can hold
+		// duplicates left by the old find-then-insert race.
+		Version:     2,
+		Description: "merge duplicate rollup documents before adding unique indexes",
+		mongo:       mongoMergeDuplicateRollups,
+		bolt:        func(tx *bolt.Tx) error { return nil },
+	},
+	{
+		Version:     3,
+		Description: "store money as {cents, currency} in sales, expenses and rollups",
+		mongo:       mongoConvertMoney,
+		bolt:        boltConvertMoney,
+	},
+	{
+		Version:     4,
+		Description: "move period rollups into one analytics collection keyed by period",
+		mongo:       mongoMergeRollupCollections,
+		bolt:        boltMergeRollupBuckets,
+	},
+	{
+		// Operating expenses were only ever added to dailyAnalysis, so they
+		// are summed from the raw expenses each period rollup covers.
+		Version:     5,
+		Description: "split period rollup expenses into cost of goods and operating expenses",
+		mongo:       mongoSplitRollupExpenses,
+		bolt:        boltSplitRollupExpenses,
+	},
+	{
+		// Rollups from before per-item stats have no items, which left the
+		// item profitability and menu engineering reports empty for them.
+		Version:     6,
+		Description: "backfill per-item stats in period rollups from raw sales",
+		mongo:       mongoBackfillRollupItems,
+		bolt:        boltBackfillRollupItems,
+	},
+}
+
+// AppliedMigration records a migration that has run against a database.
+type AppliedMigration struct {
+	Version     int       `bson:"_id" json:"version"`
+	Description string    `bson:"description" json:"description"`
+	AppliedAt   time.Time `bson:"appliedAt" json:"appliedAt"`
+}
+
+// Migrator is implemented by backends whose data outlives the process.
+type Migrator interface {
+	AppliedMigrations(ctx context.Context) ([]AppliedMigration, error)
+	// Migrate runs every pending migration and returns the ones it applied.
+	Migrate(ctx context.Context) ([]AppliedMigration, error)
+}
+
+// pendingMigrations returns the migrations not yet in applied.
+func pendingMigrations(applied []AppliedMigration) []Migration {
+	done := make(map[int]bool, len(applied))
+	for _, a := range applied {
+		done[a.Version] = true
+	}
+
+	var pending []Migration
+	for _, m := range Migrations {
+		if !done[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// Default values for expense fields written before they were required.
+const (
+	defaultExpenseCategory      = "other"
+	defaultExpensePaymentMethod = "cash"
+)
+
+// parseLegacyAmount reads an expense amount in major units stored by older
+// builds, which kept whatever the form sent ("1,200", " 350 ", "99.50"),
+// exact to the cent.
+func parseLegacyAmount(v interface{}) (models.Money, bool) {
+	t, data, err := bson.MarshalValue(v)
+	if err != nil {
+		return models.NewMoney(0), false
+	}
+	var money models.Money
+	if err := money.UnmarshalBSONValue(t, data); err != nil || t == bson.TypeNull || t == bson.TypeUndefined {
+		return models.NewMoney(0), false
+	}
+	return money, true
+}
+
+// parseLegacyInt reads a count or whole-unit total kept by older builds as
+// a number or string.
+func parseLegacyInt(v interface{}) (int, bool) {
+	switch amount := v.(type) {
+	case int32:
+		return int(amount), true
+	case int64:
+		return int(amount), true
+	case float64:
+		return int(math.Round(amount)), true
+	case string:
+		cleaned := strings.ReplaceAll(strings.TrimSpace(amount), ",", "")
+		if n, err := strconv.Atoi(cleaned); err == nil {
+			return n, true
+		}
+		if f, err := strconv.ParseFloat(cleaned, 64); err == nil {
+			return int(math.Round(f)), true
+		}
+	}
+	return 0, false
+}
+
+// backfillExpense returns the fields to set on a raw expense document so
+// it matches the current Expenses shape, or nil if it already does.
+func backfillExpense(doc bson.M) bson.M {
+	set := bson.M{}
+
+	// Whole amounts are left for migration 3 to convert. Anything else goes
+	// straight to its {cents, currency} form, since rounding it to an
+	// integer here would lose the cents.
+	switch doc["amount"].(type) {
+	case int32, int64, bson.M:
+	default:
+		amount, ok := parseLegacyAmount(doc["amount"])
+		if !ok {
+			log.Printf("Expense %v has unreadable amount %v, storing 0", doc["_id"], doc["amount"])
+		}
+		set["amount"] = bson.M{"cents": amount.Cents, "currency": amount.CurrencyCode()}
+	}
+
+	if s, _ := doc["category"].(string); s == "" {
+		set["category"] = defaultExpenseCategory
+	}
+	if _, ok := doc["description"].(string); !ok {
+		set["description"] = ""
+	}
+	if s, _ := doc["paymentMethod"].(string); s == "" {
+		set["paymentMethod"] = defaultExpensePaymentMethod
+	}
+	if _, ok := doc["timeAdded"].(primitive.DateTime); !ok {
+		if id, ok := doc["_id"].(primitive.ObjectID); ok {
+			set["timeAdded"] = id.Timestamp()
+		}
+	}
+
+	if len(set) == 0 {
+		return nil
+	}
+	return set
+}
+
+// backfillSale returns the fields to set on a raw sale document, or nil.
+func backfillSale(doc bson.M) bson.M {
+	if _, ok := doc["recordedAt"].(primitive.DateTime); ok {
+		return nil
+	}
+	if id, ok := doc["_id"].(primitive.ObjectID); ok {
+		return bson.M{"recordedAt": id.Timestamp()}
+	}
+	return nil
+}
+
+func mongoBackfillExpensesAndSales(ctx context.Context, s *MongoStore) error {
+	if err := mongoBackfill(ctx, s.ExpensesDB.Collection("dailyExpense"), backfillExpense); err != nil {
+		return fmt.Errorf("error migrating expenses: %w", err)
+	}
+	if err := mongoBackfill(ctx, s.TacoDB.Collection("dailysales"), backfillSale); err != nil {
+		return fmt.Errorf("error migrating sales: %w", err)
+	}
+	return nil
+}
+
+// mongoBackfill applies fix to every document in collection.
+func mongoBackfill(ctx context.Context, collection *mongo.Collection, fix func(bson.M) bson.M) error {
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	updated := 0
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		set := fix(doc)
+		if set == nil {
+			continue
+		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": doc["_id"]}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+		updated++
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	log.Printf("Migrated %d documents in %s", updated, collection.Name())
+	return nil
+}
+
+func boltBackfillExpensesAndSales(tx *bolt.Tx) error {
+	if err := boltBackfill(tx, expensesBucket, backfillExpense); err != nil {
+		return fmt.Errorf("error migrating expenses: %w", err)
+	}
+	if err := boltBackfill(tx, salesBucket, backfillSale); err != nil {
+		return fmt.Errorf("error migrating sales: %w", err)
+	}
+	return nil
+}
+
+// boltBackfill applies fix to every document in bucket. A bucket that was
+// never created, such as a legacy rollup bucket in a new file, is skipped.
+func boltBackfill(tx *bolt.Tx, bucket string, fix func(bson.M) bson.M) error {
+	b := tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	type change struct {
+		key  []byte
+		data []byte
+	}
+	var changes []change
+
+	err := b.ForEach(func(k, data []byte) error {
+		var doc bson.M
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		set := fix(doc)
+		if set == nil {
+			return nil
+		}
+		for field, value := range set {
+			doc[field] = value
+		}
+		updated, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, change{append([]byte(nil), k...), updated})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// bbolt does not allow writes while iterating a bucket.
+	for _, c := range changes {
+		if err := b.Put(c.key, c.data); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Migrated %d documents in %s", len(changes), bucket)
+	return nil
+}
+
+func mongoMergeDuplicateRollups(ctx context.Context, s *MongoStore) error {
+	for _, period := range legacyPeriods {
+		collection := legacyPeriodCollection(s, period)
+		key := bson.D{{Key: "period", Value: "$period"}, {Key: "startDate", Value: "$startDate"}, {Key: "endDate", Value: "$endDate"}}
+		if err := mongoMergeDuplicates(ctx, collection, key, []string{"itemsSold", "paymentMethods"}); err != nil {
+			return fmt.Errorf("error merging %s analytics: %w", period, err)
+		}
+	}
+
+	daily := s.DailyAnalytics.Collection("dailyAnalysis")
+	key := bson.D{{Key: "date", Value: "$date"}}
+	if err := mongoMergeDuplicates(ctx, daily, key, []string{"itemsSold", "paymentSummary", "expenseCategory"}); err != nil {
+		return fmt.Errorf("error merging daily analysis: %w", err)
+	}
+	return nil
+}
+
+// mongoMergeDuplicates folds documents sharing the same group key into the
+// oldest one: numeric totals and the named count maps are summed, and the
+// rest are deleted.
+func mongoMergeDuplicates(ctx context.Context, collection *mongo.Collection, key bson.D, countFields []string) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: key},
+			{Key: "ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		IDs []primitive.ObjectID `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		var docs []bson.M
+		cur, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": group.IDs}})
+		if err != nil {
+			return err
+		}
+		if err := cur.All(ctx, &docs); err != nil {
+			return err
+		}
+
+		inc := bson.M{}
+		for _, doc := range docs {
+			if doc["_id"] == group.IDs[0] {
+				continue
+			}
+			for _, field := range []string{"totalSales", "totalExpenses", "netProfit", "transactionCount"} {
+				if n, ok := parseLegacyInt(doc[field]); ok && n != 0 {
+					inc[field] = addInt(inc[field], n)
+				}
+			}
+			for _, field := range countFields {
+				counts, _ := doc[field].(bson.M)
+				for name, value := range counts {
+					if n, ok := parseLegacyInt(value); ok && n != 0 {
+						inc[field+"."+name] = addInt(inc[field+"."+name], n)
+					}
+				}
+			}
+		}
+
+		if len(inc) > 0 {
+			if _, err := collection.UpdateOne(ctx, bson.M{"_id": group.IDs[0]}, bson.M{"$inc": inc}); err != nil {
+				return err
+			}
+		}
+		if _, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": group.IDs[1:]}}); err != nil {
+			return err
+		}
+		log.Printf("Merged %d duplicate documents into %s in %s", len(group.IDs)-1, group.IDs[0].Hex(), collection.Name())
+	}
+	return nil
+}
+
+func addInt(current interface{}, n int) int {
+	total, _ := current.(int)
+	return total + n
+}
+
+// legacyMoney converts an amount stored as a plain number or string, in
+// major units, to the {cents, currency} form. It reports false for values
+// that are already converted.
+func legacyMoney(v interface{}) (bson.M, bool) {
+	if _, ok := v.(bson.M); ok {
+		return nil, false
+	}
+	t, data, err := bson.MarshalValue(v)
+	if err != nil {
+		return nil, false
+	}
+	var money models.Money
+	if err := money.UnmarshalBSONValue(t, data); err != nil {
+		log.Printf("Unreadable amount %v, storing 0", v)
+		money = models.NewMoney(0)
+	}
+	return bson.M{"cents": money.Cents, "currency": money.CurrencyCode()}, true
+}
+
+// convertMoney returns a fix that converts the named money fields and
+// every value of the named money maps.
+func convertMoney(fields []string, mapFields []string) func(bson.M) bson.M {
+	return func(doc bson.M) bson.M {
+		set := bson.M{}
+		for _, field := range fields {
+			if _, present := doc[field]; !present {
+				continue
+			}
+			if money, ok := legacyMoney(doc[field]); ok {
+				set[field] = money
+			}
+		}
+		for _, field := range mapFields {
+			amounts, _ := doc[field].(bson.M)
+			converted := bson.M{}
+			changed := false
+			for name, value := range amounts {
+				money, ok := legacyMoney(value)
+				if ok {
+					changed = true
+					converted[name] = money
+				} else {
+					converted[name] = value
+				}
+			}
+			if changed {
+				set[field] = converted
+			}
+		}
+		if len(set) == 0 {
+			return nil
+		}
+		return set
+	}
+}
+
+// convertSaleMoney converts a sale's total and its item prices and costs.
+func convertSaleMoney(doc bson.M) bson.M {
+	set := convertMoney([]string{"total"}, nil)(doc)
+
+	items, _ := doc["items"].(bson.A)
+	changed := false
+	for _, raw := range items {
+		item, ok := raw.(bson.M)
+		if !ok {
+			continue
+		}
+		for _, field := range []string{"price", "cost"} {
+			if money, ok := legacyMoney(item[field]); ok {
+				item[field] = money
+				changed = true
+			}
+		}
+	}
+	if changed {
+		if set == nil {
+			set = bson.M{}
+		}
+		set["items"] = items
+	}
+	return set
+}
+
+var (
+	expenseMoney = convertMoney([]string{"amount"}, nil)
+	dayMoney     = convertMoney([]string{"totalSales", "totalExpenses", "netProfit"}, []string{"expenseCategory"})
+	periodMoney  = convertMoney([]string{"totalSales", "totalExpenses", "netProfit"}, []string{"paymentMethods"})
+)
+
+func mongoConvertMoney(ctx context.Context, s *MongoStore) error {
+	if err := mongoBackfill(ctx, s.TacoDB.Collection("dailysales"), convertSaleMoney); err != nil {
+		return fmt.Errorf("error migrating sales: %w", err)
+	}
+	if err := mongoBackfill(ctx, s.ExpensesDB.Collection("dailyExpense"), expenseMoney); err != nil {
+		return fmt.Errorf("error migrating expenses: %w", err)
+	}
+	if err := mongoBackfill(ctx, s.DailyAnalytics.Collection("dailyAnalysis"), dayMoney); err != nil {
+		return fmt.Errorf("error migrating daily analysis: %w", err)
+	}
+	for _, period := range legacyPeriods {
+		collection := legacyPeriodCollection(s, period)
+		if err := mongoBackfill(ctx, collection, periodMoney); err != nil {
+			return fmt.Errorf("error migrating %s analytics: %w", period, err)
+		}
+	}
+	return nil
+}
+
+func boltConvertMoney(tx *bolt.Tx) error {
+	if err := boltBackfill(tx, salesBucket, convertSaleMoney); err != nil {
+		return fmt.Errorf("error migrating sales: %w", err)
+	}
+	if err := boltBackfill(tx, expensesBucket, expenseMoney); err != nil {
+		return fmt.Errorf("error migrating expenses: %w", err)
+	}
+	if err := boltBackfill(tx, dailyBucket, dayMoney); err != nil {
+		return fmt.Errorf("error migrating daily analysis: %w", err)
+	}
+	for _, period := range legacyPeriods {
+		if err := boltBackfill(tx, legacyPeriodBucket(period), periodMoney); err != nil {
+			return fmt.Errorf("error migrating %s analytics: %w", period, err)
+		}
+	}
+	return nil
+}
+
+// legacyPeriods had a database (Mongo) or bucket (bbolt) each until
+// migration 4 moved them into the analytics collection.
+var legacyPeriods = []string{"daily", "weekly", "monthly", "yearly"}
+
+func legacyPeriodCollection(s *MongoStore, period string) *mongo.Collection {
+	if period == "daily" {
+		return s.DailyAnalytics.Collection("dailyAnalytics")
+	}
+	return s.Client.Database(period + "Analytics").Collection(period + "Analytics")
+}
+
+func legacyPeriodBucket(period string) string {
+	return period + "Analytics"
+}
+
+// mongoMergeRollupCollections copies each legacy rollup collection into
+// analytics and drops it. Documents are upserted by _id, so a migration
+// interrupted half way can simply run again.
+func mongoMergeRollupCollections(ctx context.Context, s *MongoStore) error {
+	analytics := s.analyticsCollection()
+	for _, period := range legacyPeriods {
+		legacy := legacyPeriodCollection(s, period)
+
+		cursor, err := legacy.Find(ctx, bson.M{})
+		if err != nil {
+			return fmt.Errorf("error reading %s analytics: %w", period, err)
+		}
+		copied := 0
+		for cursor.Next(ctx) {
+			var doc bson.M
+			if err := cursor.Decode(&doc); err != nil {
+				cursor.Close(ctx)
+				return err
+			}
+			doc["period"] = period
+			_, err := analytics.ReplaceOne(ctx, bson.M{"_id": doc["_id"]}, doc, options.Replace().SetUpsert(true))
+			if err != nil {
+				cursor.Close(ctx)
+				return fmt.Errorf("error copying %s analytics: %w", period, err)
+			}
+			copied++
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := legacy.Drop(ctx); err != nil {
+			return fmt.Errorf("error dropping %s analytics: %w", period, err)
+		}
+		log.Printf("Moved %d %s rollups into %s", copied, period, analytics.Name())
+	}
+	return nil
+}
+
+// boltMergeRollupBuckets moves each legacy rollup bucket into the
+// analytics bucket under period-prefixed keys and deletes it.
+func boltMergeRollupBuckets(tx *bolt.Tx) error {
+	analytics, err := tx.CreateBucketIfNotExists([]byte(analyticsBucket))
+	if err != nil {
+		return err
+	}
+
+	for _, period := range legacyPeriods {
+		legacy := tx.Bucket([]byte(legacyPeriodBucket(period)))
+		if legacy == nil {
+			continue
+		}
+
+		moved := 0
+		err := legacy.ForEach(func(k, data []byte) error {
+			moved++
+			return analytics.Put(append(periodPrefix(period), k...), data)
+		})
+		if err != nil {
+			return fmt.Errorf("error moving %s analytics: %w", period, err)
+		}
+		if err := tx.DeleteBucket([]byte(legacyPeriodBucket(period))); err != nil {
+			return fmt.Errorf("error deleting %s analytics bucket: %w", period, err)
+		}
+		log.Printf("Moved %d %s rollups into %s", moved, period, analyticsBucket)
+	}
+	return nil
+}
+
+// splitRollupExpenses labels what a period rollup held as total expenses,
+// which until now was only item cost, as cost of goods, and adds the
+// operating expenses among expenses that fall in its range.
+func splitRollupExpenses(doc bson.M, expenses []models.ExpensesFetched) bson.M {
+	if _, ok := doc["costOfGoods"]; ok {
+		return nil
+	}
+	// Missing or unreadable totals count as zero.
+	costOfGoods, _ := parseLegacyAmount(doc["totalExpenses"])
+	grossProfit, _ := parseLegacyAmount(doc["netProfit"])
+
+	operating := models.NewMoney(0)
+	categories := make(map[string]models.Money)
+	if start, end, ok := rollupDates(doc); ok {
+		for _, expense := range expenses {
+			if expense.TimeAdded.Before(start) || expense.TimeAdded.After(end) {
+				continue
+			}
+			operating = operating.Add(expense.Amount)
+			categories[expense.Category] = categories[expense.Category].Add(expense.Amount)
+		}
+	}
+
+	return bson.M{
+		"costOfGoods":       costOfGoods,
+		"operatingExpenses": operating,
+		"totalExpenses":     costOfGoods.Add(operating),
+		"grossProfit":       grossProfit,
+		"netProfit":         grossProfit.Sub(operating),
+		"expenseCategories": categories,
+	}
+}
+
+func mongoSplitRollupExpenses(ctx context.Context, s *MongoStore) error {
+	cursor, err := s.ExpensesDB.Collection("dailyExpense").Find(ctx, bson.M{"voided": nil})
+	if err != nil {
+		return fmt.Errorf("error reading expenses: %w", err)
+	}
+	var expenses []models.ExpensesFetched
+	if err := cursor.All(ctx, &expenses); err != nil {
+		return fmt.Errorf("error reading expenses: %w", err)
+	}
+
+	return mongoBackfill(ctx, s.analyticsCollection(), func(doc bson.M) bson.M {
+		return splitRollupExpenses(doc, expenses)
+	})
+}
+
+func boltSplitRollupExpenses(tx *bolt.Tx) error {
+	var expenses []models.ExpensesFetched
+	if tx.Bucket([]byte(expensesBucket)) != nil {
+		err := eachDoc(tx, expensesBucket, func(data []byte) error {
+			var expense models.ExpensesFetched
+			if err := bson.Unmarshal(data, &expense); err != nil {
+				return err
+			}
+			if expense.Voided == nil {
+				expenses = append(expenses, expense)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error reading expenses: %w", err)
+		}
+	}
+
+	return boltBackfill(tx, analyticsBucket, func(doc bson.M) bson.M {
+		return splitRollupExpenses(doc, expenses)
+	})
+}
+
+// rollupItems computes the per-item stats of a period rollup from the
+// sales it covers, keyed by menu item id or, for sales recorded before
+// items had one, by name.
+func rollupItems(sales []models.SalesData) map[string]models.ItemStats {
+	items := make(map[string]models.ItemStats)
+	for _, sale := range sales {
+		for _, item := range sale.Items {
+			key := item.MenuItemId
+			if key == "" {
+				key = item.Name
+			}
+			stats := items[key]
+			stats.Name = item.Name
+			stats.Quantity += item.Quantity
+			stats.Revenue = stats.Revenue.Add(item.Price.Mul(item.Quantity))
+			stats.Cost = stats.Cost.Add(item.Cost.Mul(item.Quantity))
+			stats.Margin = stats.Revenue.Sub(stats.Cost)
+			items[key] = stats
+		}
+	}
+	return items
+}
+
+// rollupRange reads the date range of a raw rollup document. It reports
+// false for documents that already have items, or have no range.
+func rollupRange(doc bson.M) (time.Time, time.Time, bool) {
+	if _, ok := doc["items"]; ok {
+		return time.Time{}, time.Time{}, false
+	}
+	return rollupDates(doc)
+}
+
+// rollupDates reads the date range of a raw rollup document.
+func rollupDates(doc bson.M) (time.Time, time.Time, bool) {
+	start, ok1 := doc["startDate"].(primitive.DateTime)
+	end, ok2 := doc["endDate"].(primitive.DateTime)
+	return start.Time(), end.Time(), ok1 && ok2
+}
+
+func mongoBackfillRollupItems(ctx context.Context, s *MongoStore) error {
+	sales := s.Sales()
+	analytics := s.analyticsCollection()
+
+	cursor, err := analytics.Find(ctx, bson.M{"items": bson.M{"$exists": false}})
+	if err != nil {
+		return fmt.Errorf("error reading analytics: %w", err)
+	}
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return fmt.Errorf("error reading analytics: %w", err)
+	}
+
+	for _, doc := range docs {
+		start, end, ok := rollupRange(doc)
+		if !ok {
+			continue
+		}
+		covered, err := sales.SalesBetween(ctx, start, end)
+		if err != nil {
+			return fmt.Errorf("error reading sales: %w", err)
+		}
+		set := bson.M{"items": rollupItems(covered)}
+		if _, err := analytics.UpdateOne(ctx, bson.M{"_id": doc["_id"]}, bson.M{"$set": set}); err != nil {
+			return fmt.Errorf("error updating analytics: %w", err)
+		}
+	}
+	log.Printf("Backfilled items in %d rollups", len(docs))
+	return nil
+}
+
+func boltBackfillRollupItems(tx *bolt.Tx) error {
+	var all []models.SalesData
+	if tx.Bucket([]byte(salesBucket)) != nil {
+		err := eachDoc(tx, salesBucket, func(data []byte) error {
+			var sale models.SalesData
+			if err := bson.Unmarshal(data, &sale); err != nil {
+				return err
+			}
+			if sale.Voided == nil {
+				all = append(all, sale)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error reading sales: %w", err)
+		}
+	}
+
+	return boltBackfill(tx, analyticsBucket, func(doc bson.M) bson.M {
+		start, end, ok := rollupRange(doc)
+		if !ok {
+			return nil
+		}
+		var covered []models.SalesData
+		for _, sale := range all {
+			if !sale.RecordedAt.Before(start) && !sale.RecordedAt.After(end) {
+				covered = append(covered, sale)
+			}
+		}
+		return bson.M{"items": rollupItems(covered)}
+	})
+}
+
+func (s *MongoStore) migrationsCollection() *mongo.Collection {
+	return s.TacoDB.Collection("schemaMigrations")
+}
+
+func (s *MongoStore) AppliedMigrations(ctx context.Context) ([]AppliedMigration, error) {
+	cursor, err := s.migrationsCollection().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema migrations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var applied []AppliedMigration
+	if err := cursor.All(ctx, &applied); err != nil {
+		return nil, fmt.Errorf("error decoding schema migrations: %w", err)
+	}
+	return applied, nil
+}
+
+func (s *MongoStore) Migrate(ctx context.Context) ([]AppliedMigration, error) {
+	applied, err := s.AppliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []AppliedMigration
+	for _, m := range pendingMigrations(applied) {
+		log.Printf("Applying migration %d: %s", m.Version, m.Description)
+		if err := m.mongo(ctx, s); err != nil {
+			return ran, fmt.Errorf("migration %d failed: %w", m.Version, err)
+		}
+
+		record := AppliedMigration{Version: m.Version, Description: m.Description, AppliedAt: time.Now()}
+		if _, err := s.migrationsCollection().InsertOne(ctx, record); err != nil {
+			return ran, fmt.Errorf("error recording migration %d: %w", m.Version, err)
+		}
+		ran = append(ran, record)
+	}
+	return ran, nil
+}
+
+const migrationsBucket = "schemaMigrations"
+
+func migrationKey(version int) []byte {
+	return []byte(fmt.Sprintf("%08d", version))
+}
+
+func (s *BoltStore) AppliedMigrations(ctx context.Context) ([]AppliedMigration, error) {
+	var applied []AppliedMigration
+	err := view(ctx, s.db, func(tx *bolt.Tx) error {
+		return eachDoc(tx, migrationsBucket, func(data []byte) error {
+			var a AppliedMigration
+			if err := bson.Unmarshal(data, &a); err != nil {
+				return err
+			}
+			applied = append(applied, a)
+			return nil
+		})
+	})
+	return applied, err
+}
+
+// Migrate runs each pending migration in its own transaction together with
+// the record that it ran.
+func (s *BoltStore) Migrate(ctx context.Context) ([]AppliedMigration, error) {
+	applied, err := s.AppliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []AppliedMigration
+	for _, m := range pendingMigrations(applied) {
+		log.Printf("Applying migration %d: %s", m.Version, m.Description)
+
+		record := AppliedMigration{Version: m.Version, Description: m.Description, AppliedAt: time.Now()}
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			if err := m.bolt(tx); err != nil {
+				return err
+			}
+			return putDoc(tx, migrationsBucket, migrationKey(m.Version), record)
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %d failed: %w", m.Version, err)
+		}
+		ran = append(ran, record)
+	}
+	return ran, nil
+}
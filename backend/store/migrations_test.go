@@ -0,0 +1,203 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tacohut/models"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseLegacyAmount(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		cents int64
+		ok    bool
+	}{
+		{"string with cents", "99.50", 9950, true},
+		{"double", 99.5, 9950, true},
+		{"thousands separator", "1,200", 120000, true},
+		{"padded", " 350 ", 35000, true},
+		{"int32", int32(42), 4200, true},
+		{"int64", int64(42), 4200, true},
+		{"negative", "-12.25", -1225, true},
+		{"garbage", "twelve", 0, false},
+		{"missing", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseLegacyAmount(tt.value)
+			if ok != tt.ok || got.Cents != tt.cents {
+				t.Errorf("parseLegacyAmount(%#v) = %d, %v; want %d, %v", tt.value, got.Cents, ok, tt.cents, tt.ok)
+			}
+		})
+	}
+}
+
+// TestExpenseAmountMigrations runs migrations 1 and 3 over legacy expense
+// amounts and checks the cents survive both.
+func TestExpenseAmountMigrations(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		cents int64
+	}{
+		{"99.50", 9950},
+		{99.5, 9950},
+		{"1,200", 120000},
+		{int32(350), 35000},
+	}
+
+	for _, tt := range tests {
+		doc := bson.M{"amount": tt.value, "category": "supplies", "description": "", "paymentMethod": "cash"}
+		apply := func(set bson.M) {
+			for field, value := range set {
+				doc[field] = value
+			}
+		}
+		apply(backfillExpense(doc))
+		apply(expenseMoney(doc))
+
+		amount, ok := doc["amount"].(bson.M)
+		if !ok {
+			t.Errorf("amount %#v: not converted, got %#v", tt.value, doc["amount"])
+			continue
+		}
+		if amount["cents"] != tt.cents {
+			t.Errorf("amount %#v: got %v cents, want %d", tt.value, amount["cents"], tt.cents)
+		}
+	}
+}
+
+func TestBoltBackfillRollupItems(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenBolt(filepath.Join(t.TempDir(), "tacohut.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	defer s.Close(ctx)
+
+	start, end := suiteDay, suiteDay.Add(24*time.Hour-time.Nanosecond)
+	insertSale(t, s, testSale(start.Add(time.Hour), "cash", 400))
+	insertSale(t, s, testSale(start.Add(2*time.Hour), "cash", 400))
+	legacy := models.SalesData{
+		Items:      []models.MenuItem{{Name: "Horchata", Quantity: 3, Price: models.NewMoney(200), Cost: models.NewMoney(50)}},
+		Total:      models.NewMoney(600),
+		RecordedAt: start.Add(3 * time.Hour),
+	}
+	insertSale(t, s, legacy)
+	voided := insertSale(t, s, testSale(start.Add(4*time.Hour), "cash", 400))
+	if err := s.Sales().SetSaleVoid(ctx, voided, &models.Void{VoidedAt: start}); err != nil {
+		t.Fatalf("SetSaleVoid: %v", err)
+	}
+	insertSale(t, s, testSale(end.Add(time.Hour), "cash", 400))
+
+	// A rollup written before per-item stats existed.
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return putDoc(tx, analyticsBucket, periodKey("daily", start, end), bson.M{
+			"_id":        primitive.NewObjectID(),
+			"period":     "daily",
+			"startDate":  start,
+			"endDate":    end,
+			"totalSales": bson.M{"cents": int64(1400), "currency": models.Currency},
+		})
+	})
+	if err != nil {
+		t.Fatalf("putDoc: %v", err)
+	}
+
+	if err := s.db.Update(boltBackfillRollupItems); err != nil {
+		t.Fatalf("boltBackfillRollupItems: %v", err)
+	}
+
+	got, err := s.Periods().FindPeriod(ctx, "daily", start, end)
+	if err != nil {
+		t.Fatalf("FindPeriod: %v", err)
+	}
+	want := map[string]models.ItemStats{
+		"al-pastor": {Name: "Al Pastor", Quantity: 2, Revenue: models.NewMoney(800), Cost: models.NewMoney(200), Margin: models.NewMoney(600)},
+		"Horchata":  {Name: "Horchata", Quantity: 3, Revenue: models.NewMoney(600), Cost: models.NewMoney(150), Margin: models.NewMoney(450)},
+	}
+	if len(got.Items) != len(want) {
+		t.Fatalf("items = %+v, want %+v", got.Items, want)
+	}
+	for key, stats := range want {
+		if got.Items[key] != stats {
+			t.Errorf("items[%s] = %+v, want %+v", key, got.Items[key], stats)
+		}
+	}
+}
+
+func TestBoltSplitRollupExpenses(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenBolt(filepath.Join(t.TempDir(), "tacohut.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	defer s.Close(ctx)
+
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0).Add(-time.Nanosecond)
+	expense := func(at time.Time, category string, cents int64) primitive.ObjectID {
+		t.Helper()
+		id, err := s.Expenses().InsertExpense(ctx, models.Expenses{Amount: models.NewMoney(cents), Category: category, PaymentMethod: "cash", TimeAdded: at})
+		if err != nil {
+			t.Fatalf("InsertExpense: %v", err)
+		}
+		return id
+	}
+	expense(start.AddDate(0, 0, 4), "rent", 50000)
+	expense(start.AddDate(0, 0, 9), "supplies", 3000)
+	expense(start.AddDate(0, 0, 20), "supplies", 2000)
+	expense(end.Add(time.Hour), "rent", 50000)
+	voided := expense(start.AddDate(0, 0, 12), "utilities", 7000)
+	if err := s.Expenses().SetExpenseVoid(ctx, voided, &models.Void{VoidedAt: start}); err != nil {
+		t.Fatalf("SetExpenseVoid: %v", err)
+	}
+
+	// A monthly rollup whose expenses were only item cost.
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return putDoc(tx, analyticsBucket, periodKey("monthly", start, end), bson.M{
+			"_id":           primitive.NewObjectID(),
+			"period":        "monthly",
+			"startDate":     start,
+			"endDate":       end,
+			"totalSales":    bson.M{"cents": int64(100000), "currency": models.Currency},
+			"totalExpenses": bson.M{"cents": int64(25000), "currency": models.Currency},
+			"netProfit":     bson.M{"cents": int64(75000), "currency": models.Currency},
+		})
+	})
+	if err != nil {
+		t.Fatalf("putDoc: %v", err)
+	}
+
+	if err := s.db.Update(boltSplitRollupExpenses); err != nil {
+		t.Fatalf("boltSplitRollupExpenses: %v", err)
+	}
+
+	got, err := s.Periods().FindPeriod(ctx, "monthly", start, end)
+	if err != nil {
+		t.Fatalf("FindPeriod: %v", err)
+	}
+	money := map[string][2]int64{
+		"costOfGoods":       {got.CostOfGoods.Cents, 25000},
+		"operatingExpenses": {got.OperatingExpenses.Cents, 55000},
+		"totalExpenses":     {got.TotalExpenses.Cents, 80000},
+		"grossProfit":       {got.GrossProfit.Cents, 75000},
+		"netProfit":         {got.NetProfit.Cents, 20000},
+	}
+	for field, v := range money {
+		if v[0] != v[1] {
+			t.Errorf("%s = %d, want %d", field, v[0], v[1])
+		}
+	}
+	if len(got.ExpenseCategories) != 2 || got.ExpenseCategories["rent"].Cents != 50000 || got.ExpenseCategories["supplies"].Cents != 5000 {
+		t.Errorf("expenseCategories = %v, want rent 50000 and supplies 5000", got.ExpenseCategories)
+	}
+}
@@ -0,0 +1,969 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"tacohut/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is the MongoDB backend. Sales, expenses and dailyAnalysis
+// live in their own databases, as they always have; period rollups of every
+// type share the analytics collection in tacohut, keyed by period, and
+// anomalies live next to them in tacohut.anomalies.
+type MongoStore struct {
+	Client         *mongo.Client
+	TacoDB         *mongo.Database
+	ExpensesDB     *mongo.Database
+	DailyAnalytics *mongo.Database
+}
+
+// ConnectMongo connects to dbURI and pings the server before returning.
+func ConnectMongo(ctx context.Context, dbURI string) (*MongoStore, error) {
+	fmt.Println("Connecting to database...")
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(dbURI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
+	}
+	fmt.Println("Connected to MongoDB successfully!")
+
+	s := &MongoStore{
+		Client:         client,
+		TacoDB:         client.Database("tacohut"),
+		ExpensesDB:     client.Database("expenses"),
+		DailyAnalytics: client.Database("dailyExpenses"),
+	}
+
+	fmt.Println("Connected to databases:", s.TacoDB.Name(), ", ", s.ExpensesDB.Name(), ", ", s.DailyAnalytics.Name())
+	return s, nil
+}
+
+// EnsureIndexes declares the indexes the queries and rollup upserts rely
+// on. Creating an index that already exists is a no-op, so this runs on
+// every startup.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	rollupKey := mongo.IndexModel{
+		Keys:    bson.D{{Key: "period", Value: 1}, {Key: "startDate", Value: 1}, {Key: "endDate", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("period_startDate_endDate_unique"),
+	}
+
+	type collectionIndexes struct {
+		collection *mongo.Collection
+		models     []mongo.IndexModel
+	}
+
+	indexes := []collectionIndexes{
+		{s.TacoDB.Collection("dailysales"), []mongo.IndexModel{
+			{Keys: bson.D{{Key: "recordedAt", Value: -1}}},
+		}},
+		{s.ExpensesDB.Collection("dailyExpense"), []mongo.IndexModel{
+			{Keys: bson.D{{Key: "timeAdded", Value: -1}}},
+			{Keys: bson.D{{Key: "category", Value: 1}, {Key: "timeAdded", Value: -1}}},
+		}},
+		{s.DailyAnalytics.Collection("dailyAnalysis"), []mongo.IndexModel{
+			{Keys: bson.D{{Key: "date", Value: 1}}, Options: options.Index().SetUnique(true)},
+		}},
+		{s.analyticsCollection(), []mongo.IndexModel{rollupKey}},
+		{s.anomaliesCollection(), []mongo.IndexModel{
+			{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "detectedAt", Value: -1}}},
+		}},
+	}
+
+	for _, idx := range indexes {
+		names, err := idx.collection.Indexes().CreateMany(ctx, idx.models)
+		if err != nil {
+			return fmt.Errorf("error creating indexes on %s: %w", idx.collection.Name(), err)
+		}
+		log.Printf("Indexes ready on %s: %v", idx.collection.Name(), names)
+	}
+	return nil
+}
+
+func (s *MongoStore) Sales() SalesStore {
+	return mongoSales{s.TacoDB.Collection("dailysales")}
+}
+
+func (s *MongoStore) Expenses() ExpenseStore {
+	return mongoExpenses{s.ExpensesDB.Collection("dailyExpense")}
+}
+
+func (s *MongoStore) Periods() PeriodAnalyticsStore {
+	return mongoPeriods{s.analyticsCollection()}
+}
+
+func (s *MongoStore) analyticsCollection() *mongo.Collection {
+	return s.TacoDB.Collection("analytics")
+}
+
+func (s *MongoStore) Daily() DailyAnalysisStore {
+	return mongoDaily{s.DailyAnalytics.Collection("dailyAnalysis")}
+}
+
+func (s *MongoStore) Anomalies() AnomalyStore {
+	return mongoAnomalies{s.anomaliesCollection()}
+}
+
+func (s *MongoStore) anomaliesCollection() *mongo.Collection {
+	return s.TacoDB.Collection("anomalies")
+}
+
+// RunInTransaction runs fn in a multi-document transaction. Store calls made
+// with the ctx passed to fn join it; the driver may retry fn on transient
+// errors, so fn must be safe to run more than once.
+func (s *MongoStore) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := s.Client.StartSession()
+	if err != nil {
+		return fmt.Errorf("error starting session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
+}
+
+func (s *MongoStore) GetSetting(ctx context.Context, name string) (string, error) {
+	var stored setting
+	err := s.TacoDB.Collection("settings").FindOne(ctx, bson.M{"_id": name}).Decode(&stored)
+	if err == mongo.ErrNoDocuments {
+		return "", ErrNotFound
+	}
+	return stored.Value, err
+}
+
+func (s *MongoStore) PutSetting(ctx context.Context, name, value string) error {
+	_, err := s.TacoDB.Collection("settings").ReplaceOne(ctx, bson.M{"_id": name}, setting{Name: name, Value: value}, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoStore) Close(ctx context.Context) error {
+	if err := s.Client.Disconnect(ctx); err != nil {
+		return fmt.Errorf("error closing database connection: %w", err)
+	}
+	fmt.Println("Database connection closed")
+	return nil
+}
+
+type mongoSales struct {
+	collection *mongo.Collection
+}
+
+func (m mongoSales) InsertSale(ctx context.Context, sale models.SalesData) (primitive.ObjectID, error) {
+	insertResult, err := m.collection.InsertOne(ctx, sale)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return insertResult.InsertedID.(primitive.ObjectID), nil
+}
+
+func (m mongoSales) FindSale(ctx context.Context, id primitive.ObjectID) (models.SalesData, error) {
+	var sale models.SalesData
+	err := m.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&sale)
+	if err == mongo.ErrNoDocuments {
+		return sale, ErrNotFound
+	}
+	return sale, err
+}
+
+func (m mongoSales) ListSales(ctx context.Context, q SalesQuery) (SalesPage, error) {
+	filter := bson.M{"voided": nil}
+	recordedAt := bson.M{}
+	if !q.From.IsZero() {
+		recordedAt["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		recordedAt["$lte"] = q.To
+	}
+	if len(recordedAt) > 0 {
+		filter["recordedAt"] = recordedAt
+	}
+	if q.PaymentMethod != "" {
+		filter["paymentMethod"] = q.PaymentMethod
+	}
+	if q.ItemName != "" {
+		pattern := "^" + regexp.QuoteMeta(q.ItemName) + "$"
+		filter["items.name"] = primitive.Regex{Pattern: pattern, Options: "i"}
+	}
+	total := bson.M{}
+	if q.MinTotal != nil {
+		total["$gte"] = *q.MinTotal
+	}
+	if q.MaxTotal != nil {
+		total["$lte"] = *q.MaxTotal
+	}
+	if len(total) > 0 {
+		filter["total.cents"] = total
+	}
+
+	count, err := m.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return SalesPage{}, err
+	}
+
+	sortField := "recordedAt"
+	if q.SortBy == SortTotal {
+		sortField = "total.cents"
+	}
+	direction, op := 1, "$gt"
+	if q.Descending {
+		direction, op = -1, "$lt"
+	}
+
+	// Keyset pagination: rows strictly after the cursor in (sort field, _id)
+	// order.
+	if q.After != nil {
+		var value interface{} = q.After.Time
+		if q.SortBy == SortTotal {
+			value = q.After.Cents
+		}
+		filter = bson.M{"$and": bson.A{filter, bson.M{"$or": bson.A{
+			bson.M{sortField: bson.M{op: value}},
+			bson.M{sortField: value, "_id": bson.M{op: q.After.ID}},
+		}}}}
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: sortField, Value: direction}, {Key: "_id", Value: direction}})
+	if q.Limit > 0 {
+		findOptions.SetLimit(int64(q.Limit) + 1)
+	}
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return SalesPage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var salesItems []models.SalesData
+	if err = cursor.All(ctx, &salesItems); err != nil {
+		return SalesPage{}, err
+	}
+
+	page := SalesPage{Sales: salesItems, Total: count}
+	if q.Limit > 0 && len(salesItems) > q.Limit {
+		page.Sales = salesItems[:q.Limit]
+		next := q.cursorOf(page.Sales[q.Limit-1])
+		page.Next = &next
+	}
+	return page, nil
+}
+
+func (m mongoSales) SalesBetween(ctx context.Context, from, to time.Time) ([]models.SalesData, error) {
+	filter := bson.M{"recordedAt": bson.M{"$gte": from, "$lte": to}, "voided": nil}
+	findOptions := options.Find().SetSort(bson.D{{Key: "recordedAt", Value: 1}})
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var salesItems []models.SalesData
+	if err = cursor.All(ctx, &salesItems); err != nil {
+		return nil, err
+	}
+	return salesItems, nil
+}
+
+// SalesByHour groups in the database. The weekday is taken after moving
+// recordedAt back by the day start hour, the same shift Calendar applies.
+func (m mongoSales) SalesByHour(ctx context.Context, q HourQuery) ([]HourTotal, error) {
+	timezone := q.Location.String()
+	shifted := bson.D{{Key: "$subtract", Value: bson.A{"$recordedAt", int64(q.DayStartHour) * int64(time.Hour/time.Millisecond)}}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"recordedAt": bson.M{"$gte": q.From, "$lte": q.To}, "voided": nil}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "weekday", Value: bson.D{{Key: "$dayOfWeek", Value: bson.D{{Key: "date", Value: shifted}, {Key: "timezone", Value: timezone}}}}},
+				{Key: "hour", Value: bson.D{{Key: "$hour", Value: bson.D{{Key: "date", Value: "$recordedAt"}, {Key: "timezone", Value: timezone}}}}},
+			}},
+			{Key: "sales", Value: bson.D{{Key: "$sum", Value: "$total.cents"}}},
+			{Key: "transactions", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "items", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$sum", Value: "$items.quantity"}}}}},
+		}}},
+	}
+	cursor, err := m.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		ID struct {
+			Weekday int `bson:"weekday"` // 1 is Sunday
+			Hour    int `bson:"hour"`
+		} `bson:"_id"`
+		Sales        int64 `bson:"sales"`
+		Transactions int   `bson:"transactions"`
+		Items        int   `bson:"items"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	totals := make([]HourTotal, len(groups))
+	for i, group := range groups {
+		totals[i] = HourTotal{
+			Weekday:      time.Weekday(group.ID.Weekday - 1),
+			Hour:         group.ID.Hour,
+			Sales:        group.Sales,
+			Transactions: group.Transactions,
+			Items:        group.Items,
+		}
+	}
+	return totals, nil
+}
+
+func (m mongoSales) SalesByMethodBefore(ctx context.Context, t time.Time) (map[string]int64, error) {
+	return sumByMethod(ctx, m.collection, bson.M{"recordedAt": bson.M{"$lt": t}, "voided": nil}, "$total.cents")
+}
+
+func (m mongoSales) ListVoidedSales(ctx context.Context) ([]models.SalesData, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "voided.voidedAt", Value: -1}})
+	cursor, err := m.collection.Find(ctx, bson.M{"voided": bson.M{"$ne": nil}}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var salesItems []models.SalesData
+	if err = cursor.All(ctx, &salesItems); err != nil {
+		return nil, err
+	}
+	return salesItems, nil
+}
+
+func (m mongoSales) SetSaleVoid(ctx context.Context, id primitive.ObjectID, void *models.Void) error {
+	return setVoid(ctx, m.collection, id, void)
+}
+
+func (m mongoSales) ReplaceSale(ctx context.Context, id primitive.ObjectID, sale models.SalesData) error {
+	sale.ID = id
+	result, err := m.collection.ReplaceOne(ctx, bson.M{"_id": id}, sale)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoExpenses struct {
+	collection *mongo.Collection
+}
+
+func (m mongoExpenses) InsertExpense(ctx context.Context, expense models.Expenses) (primitive.ObjectID, error) {
+	insertResult, err := m.collection.InsertOne(ctx, expense)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return insertResult.InsertedID.(primitive.ObjectID), nil
+}
+
+func (m mongoExpenses) FindExpense(ctx context.Context, id primitive.ObjectID) (models.ExpensesFetched, error) {
+	var expense models.ExpensesFetched
+	err := m.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&expense)
+	if err == mongo.ErrNoDocuments {
+		return expense, ErrNotFound
+	}
+	return expense, err
+}
+
+func (m mongoExpenses) ListExpenses(ctx context.Context, q ExpenseQuery) (ExpensePage, error) {
+	filter := bson.M{"voided": nil}
+	timeAdded := bson.M{}
+	if !q.From.IsZero() {
+		timeAdded["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		timeAdded["$lte"] = q.To
+	}
+	if len(timeAdded) > 0 {
+		filter["timeAdded"] = timeAdded
+	}
+	if q.Category != "" {
+		filter["category"] = q.Category
+	}
+	if q.PaymentMethod != "" {
+		filter["paymentMethod"] = q.PaymentMethod
+	}
+	if q.Description != "" {
+		filter["description"] = primitive.Regex{Pattern: regexp.QuoteMeta(q.Description), Options: "i"}
+	}
+
+	// The footer covers the whole filtered set, so it is computed before
+	// the cursor narrows the filter.
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$category"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "cents", Value: bson.D{{Key: "$sum", Value: "$amount.cents"}}},
+		}}},
+	}
+	groupCursor, err := m.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return ExpensePage{}, err
+	}
+	var groups []struct {
+		Category string `bson:"_id"`
+		Count    int64  `bson:"count"`
+		Cents    int64  `bson:"cents"`
+	}
+	if err := groupCursor.All(ctx, &groups); err != nil {
+		return ExpensePage{}, err
+	}
+
+	page := ExpensePage{Categories: make(map[string]CategoryTotal)}
+	for _, group := range groups {
+		page.Categories[group.Category] = CategoryTotal{Count: group.Count, Amount: models.NewMoney(group.Cents)}
+		page.Total += group.Count
+	}
+
+	direction, op := 1, "$gt"
+	if q.Descending {
+		direction, op = -1, "$lt"
+	}
+	if q.After != nil {
+		filter = bson.M{"$and": bson.A{filter, bson.M{"$or": bson.A{
+			bson.M{"timeAdded": bson.M{op: q.After.Time}},
+			bson.M{"timeAdded": q.After.Time, "_id": bson.M{op: q.After.ID}},
+		}}}}
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "timeAdded", Value: direction}, {Key: "_id", Value: direction}})
+	if q.Limit > 0 {
+		findOptions.SetLimit(int64(q.Limit) + 1)
+	}
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return ExpensePage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &page.Expenses); err != nil {
+		return ExpensePage{}, err
+	}
+	if q.Limit > 0 && len(page.Expenses) > q.Limit {
+		page.Expenses = page.Expenses[:q.Limit]
+		next := expenseCursor(page.Expenses[q.Limit-1])
+		page.Next = &next
+	}
+	return page, nil
+}
+
+func (m mongoExpenses) ExpensesBetween(ctx context.Context, from, to time.Time) ([]models.ExpensesFetched, error) {
+	filter := bson.M{"timeAdded": bson.M{"$gte": from, "$lte": to}, "voided": nil}
+	findOptions := options.Find().SetSort(bson.D{{Key: "timeAdded", Value: 1}})
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var expenses []models.ExpensesFetched
+	if err = cursor.All(ctx, &expenses); err != nil {
+		return nil, err
+	}
+	return expenses, nil
+}
+
+func (m mongoExpenses) ExpensesByMethodBefore(ctx context.Context, t time.Time) (map[string]int64, error) {
+	return sumByMethod(ctx, m.collection, bson.M{"timeAdded": bson.M{"$lt": t}, "voided": nil}, "$amount.cents")
+}
+
+func (m mongoExpenses) ListVoidedExpenses(ctx context.Context) ([]models.ExpensesFetched, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "voided.voidedAt", Value: -1}})
+	cursor, err := m.collection.Find(ctx, bson.M{"voided": bson.M{"$ne": nil}}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var expenses []models.ExpensesFetched
+	if err = cursor.All(ctx, &expenses); err != nil {
+		return nil, err
+	}
+	return expenses, nil
+}
+
+func (m mongoExpenses) SetExpenseVoid(ctx context.Context, id primitive.ObjectID, void *models.Void) error {
+	return setVoid(ctx, m.collection, id, void)
+}
+
+func (m mongoExpenses) ReplaceExpense(ctx context.Context, id primitive.ObjectID, expense models.ExpensesFetched) error {
+	expense.ID = id
+	result, err := m.collection.ReplaceOne(ctx, bson.M{"_id": id}, expense)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// setVoid sets or, for a nil void, clears the voided field of a document.
+func setVoid(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, void *models.Void) error {
+	update := bson.M{"$unset": bson.M{"voided": ""}}
+	if void != nil {
+		update = bson.M{"$set": bson.M{"voided": void}}
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoPeriods struct {
+	collection *mongo.Collection
+}
+
+func (m mongoPeriods) FindPeriod(ctx context.Context, period string, startDate, endDate time.Time) (models.AnalyticsSummary, error) {
+	var analytics models.AnalyticsSummary
+
+	if err := validPeriod(period); err != nil {
+		return analytics, err
+	}
+
+	err := m.collection.FindOne(ctx, bson.M{
+		"period":    period,
+		"startDate": startDate,
+		"endDate":   endDate,
+	}).Decode(&analytics)
+	if err == mongo.ErrNoDocuments {
+		return analytics, ErrNotFound
+	}
+	return analytics, err
+}
+
+func (m mongoPeriods) ListPeriods(ctx context.Context, period string) ([]models.AnalyticsSummary, error) {
+	if err := validPeriod(period); err != nil {
+		return nil, err
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "startDate", Value: -1}})
+	cursor, err := m.collection.Find(ctx, bson.M{"period": period}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s analytics: %w", period, err)
+	}
+	defer cursor.Close(ctx)
+
+	var summaries []models.AnalyticsSummary
+	if err = cursor.All(ctx, &summaries); err != nil {
+		return nil, fmt.Errorf("error decoding %s analytics: %w", period, err)
+	}
+	return summaries, nil
+}
+
+func (m mongoPeriods) PeriodsBetween(ctx context.Context, period string, from, to time.Time) ([]models.AnalyticsSummary, error) {
+	if err := validPeriod(period); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"period": period, "startDate": bson.M{"$gte": from, "$lte": to}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "startDate", Value: 1}})
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s analytics: %w", period, err)
+	}
+	defer cursor.Close(ctx)
+
+	var summaries []models.AnalyticsSummary
+	if err = cursor.All(ctx, &summaries); err != nil {
+		return nil, fmt.Errorf("error decoding %s analytics: %w", period, err)
+	}
+	return summaries, nil
+}
+
+// IncrementPeriod upserts on the rollup key, so concurrent sales in a new
+// period land in one document; see upsertOne for a lost insert race.
+func (m mongoPeriods) IncrementPeriod(ctx context.Context, period string, startDate, endDate time.Time, delta models.AnalyticsDelta) error {
+	if err := validPeriod(period); err != nil {
+		return err
+	}
+
+	filter := bson.M{
+		"period":    period,
+		"startDate": startDate,
+		"endDate":   endDate,
+	}
+
+	inc := bson.M{"transactionCount": delta.TransactionCount}
+	set := bson.M{"lastUpdated": time.Now()}
+	addMoneyIncrement(inc, set, "totalSales", delta.TotalSales)
+	addMoneyIncrement(inc, set, "totalExpenses", delta.TotalExpenses)
+	addMoneyIncrement(inc, set, "costOfGoods", delta.CostOfGoods)
+	addMoneyIncrement(inc, set, "operatingExpenses", delta.TotalExpenses-delta.CostOfGoods)
+	addMoneyIncrement(inc, set, "grossProfit", delta.TotalSales-delta.CostOfGoods)
+	addMoneyIncrement(inc, set, "netProfit", delta.TotalSales-delta.TotalExpenses)
+	addIncrements(inc, "itemsSold", delta.ItemsSold)
+	for category, cents := range delta.ExpenseCategories {
+		if category != "" && cents != 0 {
+			addMoneyIncrement(inc, set, "expenseCategories."+category, cents)
+		}
+	}
+	for key, d := range delta.Items {
+		if key == "" {
+			continue
+		}
+		field := "items." + key
+		if d.Name != "" {
+			set[field+".name"] = d.Name
+		}
+		if d.Quantity != 0 {
+			inc[field+".quantity"] = d.Quantity
+		}
+		addMoneyIncrement(inc, set, field+".revenue", d.Revenue)
+		addMoneyIncrement(inc, set, field+".cost", d.Cost)
+		addMoneyIncrement(inc, set, field+".margin", d.Revenue-d.Cost)
+	}
+	for method, cents := range delta.PaymentMethods {
+		if method != "" && cents != 0 {
+			addMoneyIncrement(inc, set, "paymentMethods."+method, cents)
+		}
+	}
+
+	update := bson.M{
+		"$set": set,
+		"$inc": inc,
+	}
+
+	result, err := upsertOne(ctx, m.collection, filter, update)
+	if err != nil {
+		return fmt.Errorf("error updating %s analytics: %w", period, err)
+	}
+
+	if result.UpsertedCount > 0 {
+		log.Printf("Created new %s analytics for period: %s to %s", period, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	} else {
+		log.Printf("Updated %s analytics for period: %s to %s", period, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	}
+	return nil
+}
+
+func (m mongoPeriods) DeletePeriod(ctx context.Context, period string, startDate, endDate time.Time) error {
+	if err := validPeriod(period); err != nil {
+		return err
+	}
+
+	result, err := m.collection.DeleteMany(ctx, bson.M{
+		"period":    period,
+		"startDate": startDate,
+		"endDate":   endDate,
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting %s analytics: %w", period, err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m mongoPeriods) ClearPeriods(ctx context.Context, period string) error {
+	if err := validPeriod(period); err != nil {
+		return err
+	}
+
+	if _, err := m.collection.DeleteMany(ctx, bson.M{"period": period}); err != nil {
+		return fmt.Errorf("error clearing %s analytics: %w", period, err)
+	}
+	return nil
+}
+
+type mongoDaily struct {
+	collection *mongo.Collection
+}
+
+func (m mongoDaily) FindDay(ctx context.Context, date time.Time) (models.DailyData, error) {
+	var day models.DailyData
+	err := m.collection.FindOne(ctx, bson.M{"date": date}).Decode(&day)
+	if err == mongo.ErrNoDocuments {
+		return day, ErrNotFound
+	}
+	return day, err
+}
+
+func (m mongoDaily) ListDays(ctx context.Context) ([]models.DailyData, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "date", Value: -1}})
+	cursor, err := m.collection.Find(ctx, bson.M{}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching analytics: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var days []models.DailyData
+	if err = cursor.All(ctx, &days); err != nil {
+		return nil, fmt.Errorf("error decoding analytics: %w", err)
+	}
+	return days, nil
+}
+
+func (m mongoDaily) DaysBetween(ctx context.Context, from, to time.Time) ([]models.DailyData, error) {
+	filter := bson.M{"date": bson.M{"$gte": from, "$lte": to}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "date", Value: 1}})
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching analytics: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var days []models.DailyData
+	if err = cursor.All(ctx, &days); err != nil {
+		return nil, fmt.Errorf("error decoding analytics: %w", err)
+	}
+	return days, nil
+}
+
+// IncrementDay upserts on the unique date, so the first sales and expenses
+// of a day land in one document; see upsertOne for a lost insert race.
+func (m mongoDaily) IncrementDay(ctx context.Context, date time.Time, delta models.AnalyticsDelta) error {
+	filter := bson.M{"date": date}
+
+	inc := bson.M{}
+	set := bson.M{"lastUpdated": time.Now()}
+	addMoneyIncrement(inc, set, "totalSales", delta.TotalSales)
+	addMoneyIncrement(inc, set, "totalExpenses", delta.TotalExpenses)
+	addIncrements(inc, "itemsSold", delta.ItemsSold)
+	addIncrements(inc, "paymentSummary", delta.PaymentMethods)
+	for category, cents := range delta.ExpenseCategories {
+		if category != "" && cents != 0 {
+			addMoneyIncrement(inc, set, "expenseCategory."+category, cents)
+		}
+	}
+
+	update := bson.M{
+		"$inc": inc,
+		"$set": set,
+	}
+
+	if _, err := upsertOne(ctx, m.collection, filter, update); err != nil {
+		return fmt.Errorf("error updating daily analysis: %w", err)
+	}
+
+	return m.recalculateDailyProfit(ctx, date)
+}
+
+func (m mongoDaily) recalculateDailyProfit(ctx context.Context, date time.Time) error {
+	filter := bson.M{"date": date}
+
+	var dailyData models.DailyData
+	if err := m.collection.FindOne(ctx, filter).Decode(&dailyData); err != nil {
+		return fmt.Errorf("error finding daily data: %v", err)
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"netProfit":   dailyData.TotalSales.Sub(dailyData.TotalExpenses),
+			"lastUpdated": time.Now(),
+		},
+	}
+
+	if _, err := m.collection.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("error updating profit: %v", err)
+	}
+
+	return nil
+}
+
+func (m mongoDaily) DeleteDay(ctx context.Context, id primitive.ObjectID) error {
+	result, err := m.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m mongoDaily) DeleteDayByDate(ctx context.Context, date time.Time) error {
+	result, err := m.collection.DeleteMany(ctx, bson.M{"date": date})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoAnomalies struct {
+	collection *mongo.Collection
+}
+
+// UpsertAnomaly upserts on the unique key index from EnsureIndexes; see
+// upsertOne for a lost insert race.
+func (m mongoAnomalies) UpsertAnomaly(ctx context.Context, a models.Anomaly) error {
+	filter := bson.M{"key": a.Key}
+	update := bson.M{
+		"$set": bson.M{
+			"kind":       a.Kind,
+			"severity":   a.Severity,
+			"title":      a.Title,
+			"message":    a.Message,
+			"subject":    a.Subject,
+			"occurredAt": a.OccurredAt,
+		},
+		"$setOnInsert": bson.M{
+			"detectedAt":   a.DetectedAt,
+			"acknowledged": false,
+		},
+	}
+
+	_, err := upsertOne(ctx, m.collection, filter, update)
+	if err != nil {
+		return fmt.Errorf("error saving anomaly %s: %w", a.Key, err)
+	}
+	return nil
+}
+
+func (m mongoAnomalies) ResolveAnomaly(ctx context.Context, key string) error {
+	if _, err := m.collection.DeleteOne(ctx, bson.M{"key": key}); err != nil {
+		return fmt.Errorf("error resolving anomaly %s: %w", key, err)
+	}
+	return nil
+}
+
+func (m mongoAnomalies) ListAnomalies(ctx context.Context, q AnomalyQuery) ([]models.Anomaly, error) {
+	filter := bson.M{}
+	if q.Open {
+		filter["acknowledged"] = false
+	}
+	if q.Severity != "" {
+		filter["severity"] = q.Severity
+	}
+	if !q.Since.IsZero() {
+		filter["detectedAt"] = bson.M{"$gte": q.Since}
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "detectedAt", Value: -1}})
+	if q.Limit > 0 {
+		findOptions.SetLimit(int64(q.Limit))
+	}
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching anomalies: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	anomalies := []models.Anomaly{}
+	if err := cursor.All(ctx, &anomalies); err != nil {
+		return nil, fmt.Errorf("error decoding anomalies: %w", err)
+	}
+	return anomalies, nil
+}
+
+func (m mongoAnomalies) AcknowledgeAnomaly(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	update := bson.M{"$set": bson.M{"acknowledged": true, "acknowledgedAt": at}}
+	result, err := m.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// upsertOne upserts update on filter. When two upserts race to insert the
+// same new key, the unique index fails the loser with a duplicate key error.
+// Outside a transaction the loser retries as a plain update. Inside one the
+// server has already aborted the transaction, so the error is labelled
+// transient and WithTransaction runs the whole transaction again.
+func upsertOne(ctx context.Context, collection *mongo.Collection, filter, update interface{}) (*mongo.UpdateResult, error) {
+	result, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if !mongo.IsDuplicateKeyError(err) {
+		return result, err
+	}
+	if mongo.SessionFromContext(ctx) != nil {
+		return nil, transientError{err}
+	}
+	return collection.UpdateOne(ctx, filter, update)
+}
+
+// transientError carries the TransientTransactionError label that tells
+// session.WithTransaction to retry.
+type transientError struct {
+	error
+}
+
+func (e transientError) HasErrorLabel(label string) bool {
+	return label == "TransientTransactionError"
+}
+
+func (e transientError) Unwrap() error {
+	return e.error
+}
+
+// sumByMethod groups the documents matching filter by payment method and
+// sums the cents at field.
+func sumByMethod(ctx context.Context, collection *mongo.Collection, filter bson.M, field string) (map[string]int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$paymentMethod"},
+			{Key: "cents", Value: bson.D{{Key: "$sum", Value: field}}},
+		}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		Method string `bson:"_id"`
+		Cents  int64  `bson:"cents"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]int64, len(groups))
+	for _, group := range groups {
+		totals[group.Method] += group.Cents
+	}
+	return totals, nil
+}
+
+// addIncrements adds one "$inc" entry per map key under the given field.
+func addIncrements[V int | int64](inc bson.M, field string, counts map[string]V) {
+	for key, value := range counts {
+		if key == "" || value == 0 {
+			continue
+		}
+		inc[field+"."+key] = value
+	}
+}
+
+// addMoneyIncrement increments a Money field stored as {cents, currency}.
+// The currency is set alongside so an upserted document gets a complete
+// value.
+func addMoneyIncrement(inc, set bson.M, field string, cents int64) {
+	inc[field+".cents"] = cents
+	set[field+".currency"] = models.Currency
+}
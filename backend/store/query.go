@@ -0,0 +1,331 @@
+package store
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"time"
+
+	"tacohut/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sort fields accepted by SalesQuery.SortBy.
+const (
+	SortRecordedAt = "recordedAt"
+	SortTotal      = "total"
+)
+
+// PageCursor marks the last row of a page. Listings are ordered by the sort
+// field and then by _id, so the cursor carries both; only the field
+// matching the query's sort is used. Time is recordedAt for sales and
+// timeAdded for expenses.
+type PageCursor struct {
+	Time  time.Time
+	Cents int64
+	ID    primitive.ObjectID
+}
+
+// SalesQuery filters and pages ListSales. Zero values mean "no filter".
+type SalesQuery struct {
+	From, To      time.Time // on recordedAt, inclusive
+	PaymentMethod string
+	ItemName      string // any line item with this name, case-insensitive
+	MinTotal      *int64 // cents, inclusive
+	MaxTotal      *int64
+
+	SortBy     string // SortRecordedAt (default) or SortTotal
+	Descending bool
+
+	After *PageCursor
+	Limit int
+}
+
+// SalesPage is one page of a sales listing. Total counts every sale that
+// matches the filters, across all pages; Next is nil on the last page.
+type SalesPage struct {
+	Sales []models.SalesData
+	Total int64
+	Next  *PageCursor
+}
+
+func (q SalesQuery) matches(sale models.SalesData) bool {
+	if sale.Voided != nil {
+		return false
+	}
+	if !q.From.IsZero() && sale.RecordedAt.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && sale.RecordedAt.After(q.To) {
+		return false
+	}
+	if q.PaymentMethod != "" && sale.PaymentMethod != q.PaymentMethod {
+		return false
+	}
+	if q.MinTotal != nil && sale.Total.Cents < *q.MinTotal {
+		return false
+	}
+	if q.MaxTotal != nil && sale.Total.Cents > *q.MaxTotal {
+		return false
+	}
+	if q.ItemName != "" {
+		found := false
+		for _, item := range sale.Items {
+			if strings.EqualFold(item.Name, q.ItemName) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (q SalesQuery) cursorOf(sale models.SalesData) PageCursor {
+	id, _ := sale.ID.(primitive.ObjectID)
+	return PageCursor{Time: sale.RecordedAt, Cents: sale.Total.Cents, ID: id}
+}
+
+// compare orders two cursors by the query's sort field and then by id,
+// ascending; callers flip it for descending listings.
+func (q SalesQuery) compare(a, b PageCursor) int {
+	if q.SortBy == SortTotal {
+		if a.Cents != b.Cents {
+			if a.Cents < b.Cents {
+				return -1
+			}
+			return 1
+		}
+	} else if c := a.Time.Compare(b.Time); c != 0 {
+		return c
+	}
+	return bytes.Compare(a.ID[:], b.ID[:])
+}
+
+// pageSales applies q to every stored sale. Backends without a query
+// engine of their own use it.
+func pageSales(all []models.SalesData, q SalesQuery) SalesPage {
+	order := func(a, b PageCursor) int {
+		if q.Descending {
+			return -q.compare(a, b)
+		}
+		return q.compare(a, b)
+	}
+
+	var matched []models.SalesData
+	for _, sale := range all {
+		if q.matches(sale) {
+			matched = append(matched, sale)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return order(q.cursorOf(matched[i]), q.cursorOf(matched[j])) < 0
+	})
+
+	page := SalesPage{Total: int64(len(matched))}
+	for _, sale := range matched {
+		if q.After != nil && order(q.cursorOf(sale), *q.After) <= 0 {
+			continue
+		}
+		if q.Limit > 0 && len(page.Sales) == q.Limit {
+			next := q.cursorOf(page.Sales[len(page.Sales)-1])
+			page.Next = &next
+			break
+		}
+		page.Sales = append(page.Sales, sale)
+	}
+	return page
+}
+
+// ExpenseQuery filters and pages ListExpenses. Expenses are always ordered
+// by timeAdded.
+type ExpenseQuery struct {
+	From, To      time.Time // on timeAdded, inclusive
+	Category      string
+	PaymentMethod string
+	Description   string // substring, case-insensitive
+
+	Descending bool
+	After      *PageCursor
+	Limit      int
+}
+
+// CategoryTotal sums the expenses of one category.
+type CategoryTotal struct {
+	Count  int64        `json:"count"`
+	Amount models.Money `json:"amount"`
+}
+
+// ExpensePage is one page of an expenses listing. Total and Categories
+// cover every expense matching the filters, not just this page.
+type ExpensePage struct {
+	Expenses   []models.ExpensesFetched
+	Total      int64
+	Categories map[string]CategoryTotal
+	Next       *PageCursor
+}
+
+func (q ExpenseQuery) matches(expense models.ExpensesFetched) bool {
+	if expense.Voided != nil {
+		return false
+	}
+	if !q.From.IsZero() && expense.TimeAdded.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && expense.TimeAdded.After(q.To) {
+		return false
+	}
+	if q.Category != "" && expense.Category != q.Category {
+		return false
+	}
+	if q.PaymentMethod != "" && expense.PaymentMethod != q.PaymentMethod {
+		return false
+	}
+	if q.Description != "" && !strings.Contains(strings.ToLower(expense.Description), strings.ToLower(q.Description)) {
+		return false
+	}
+	return true
+}
+
+func expenseCursor(expense models.ExpensesFetched) PageCursor {
+	id, _ := expense.ID.(primitive.ObjectID)
+	return PageCursor{Time: expense.TimeAdded, ID: id}
+}
+
+// pageExpenses is the in-process counterpart of pageSales.
+func pageExpenses(all []models.ExpensesFetched, q ExpenseQuery) ExpensePage {
+	order := func(a, b PageCursor) int {
+		c := a.Time.Compare(b.Time)
+		if c == 0 {
+			c = bytes.Compare(a.ID[:], b.ID[:])
+		}
+		if q.Descending {
+			return -c
+		}
+		return c
+	}
+
+	page := ExpensePage{Categories: make(map[string]CategoryTotal)}
+	var matched []models.ExpensesFetched
+	for _, expense := range all {
+		if !q.matches(expense) {
+			continue
+		}
+		matched = append(matched, expense)
+
+		total := page.Categories[expense.Category]
+		total.Count++
+		total.Amount = total.Amount.Add(expense.Amount)
+		page.Categories[expense.Category] = total
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return order(expenseCursor(matched[i]), expenseCursor(matched[j])) < 0
+	})
+
+	page.Total = int64(len(matched))
+	for _, expense := range matched {
+		if q.After != nil && order(expenseCursor(expense), *q.After) <= 0 {
+			continue
+		}
+		if q.Limit > 0 && len(page.Expenses) == q.Limit {
+			next := expenseCursor(page.Expenses[len(page.Expenses)-1])
+			page.Next = &next
+			break
+		}
+		page.Expenses = append(page.Expenses, expense)
+	}
+	return page
+}
+
+// HourQuery buckets sales by weekday and clock hour in Location. The
+// weekday is that of the business day, which starts at DayStartHour, so a
+// sale at 01:00 after a late shift counts towards the shift's day.
+type HourQuery struct {
+	From, To     time.Time // on recordedAt, inclusive
+	Location     *time.Location
+	DayStartHour int
+}
+
+// HourTotal sums the sales of one weekday and hour. Items counts
+// quantities across line items.
+type HourTotal struct {
+	Weekday      time.Weekday
+	Hour         int
+	Sales        int64 // cents
+	Transactions int
+	Items        int
+}
+
+// hourTotals is the in-process counterpart of the Mongo hour aggregation.
+// It only returns buckets with sales.
+func hourTotals(sales []models.SalesData, q HourQuery) []HourTotal {
+	type bucket struct {
+		weekday time.Weekday
+		hour    int
+	}
+	totals := make(map[bucket]*HourTotal)
+	var order []bucket
+
+	for _, sale := range sales {
+		local := sale.RecordedAt.In(q.Location)
+		b := bucket{local.Add(-time.Duration(q.DayStartHour) * time.Hour).Weekday(), local.Hour()}
+		total, ok := totals[b]
+		if !ok {
+			total = &HourTotal{Weekday: b.weekday, Hour: b.hour}
+			totals[b] = total
+			order = append(order, b)
+		}
+		total.Sales += sale.Total.Cents
+		total.Transactions++
+		for _, item := range sale.Items {
+			total.Items += item.Quantity
+		}
+	}
+
+	result := make([]HourTotal, 0, len(order))
+	for _, b := range order {
+		result = append(result, *totals[b])
+	}
+	return result
+}
+
+// AnomalyQuery filters ListAnomalies. Zero values mean "no filter".
+type AnomalyQuery struct {
+	Open     bool // only anomalies not yet acknowledged
+	Severity string
+	Since    time.Time // on detectedAt, inclusive
+	Limit    int
+}
+
+func (q AnomalyQuery) matches(a models.Anomaly) bool {
+	if q.Open && a.Acknowledged {
+		return false
+	}
+	if q.Severity != "" && a.Severity != q.Severity {
+		return false
+	}
+	if !q.Since.IsZero() && a.DetectedAt.Before(q.Since) {
+		return false
+	}
+	return true
+}
+
+// listAnomalies is the in-process counterpart of the Mongo anomaly query.
+func listAnomalies(all []models.Anomaly, q AnomalyQuery) []models.Anomaly {
+	matched := []models.Anomaly{}
+	for _, a := range all {
+		if q.matches(a) {
+			matched = append(matched, a)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].DetectedAt.After(matched[j].DetectedAt)
+	})
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+	return matched
+}
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"tacohut/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrNotFound = errors.New("store: document not found")
+
+// Store bundles the collections the handlers work with. Each backend
+// (Mongo, bbolt, in-memory) provides all five stores and a way to release
+// them.
+type Store interface {
+	Sales() SalesStore
+	Expenses() ExpenseStore
+	Periods() PeriodAnalyticsStore
+	Daily() DailyAnalysisStore
+	Anomalies() AnomalyStore
+
+	// RunInTransaction commits every store call fn makes with the ctx it is
+	// given, or none of them if fn returns an error.
+	RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+
+	Close(ctx context.Context) error
+}
+
+// SalesStore holds raw sales as recorded at the counter. Sales are never
+// deleted, only voided; ListSales and SalesBetween skip voided sales.
+type SalesStore interface {
+	InsertSale(ctx context.Context, sale models.SalesData) (primitive.ObjectID, error)
+	// FindSale returns a sale whether or not it is voided.
+	FindSale(ctx context.Context, id primitive.ObjectID) (models.SalesData, error)
+	ListSales(ctx context.Context, q SalesQuery) (SalesPage, error)
+	// SalesBetween returns sales recorded in [from, to], oldest first.
+	SalesBetween(ctx context.Context, from, to time.Time) ([]models.SalesData, error)
+	// SalesByHour totals sales by weekday and hour, skipping empty buckets.
+	SalesByHour(ctx context.Context, q HourQuery) ([]HourTotal, error)
+	// SalesByMethodBefore sums the cents of sales recorded before t per
+	// payment method.
+	SalesByMethodBefore(ctx context.Context, t time.Time) (map[string]int64, error)
+	// ListVoidedSales returns the trash, most recently voided first.
+	ListVoidedSales(ctx context.Context) ([]models.SalesData, error)
+	// SetSaleVoid voids a sale, or restores it when void is nil.
+	SetSaleVoid(ctx context.Context, id primitive.ObjectID, void *models.Void) error
+	// ReplaceSale overwrites the stored sale with id.
+	ReplaceSale(ctx context.Context, id primitive.ObjectID, sale models.SalesData) error
+}
+
+// ExpenseStore holds raw expenses, which like sales are voided rather than
+// deleted.
+type ExpenseStore interface {
+	InsertExpense(ctx context.Context, expense models.Expenses) (primitive.ObjectID, error)
+	FindExpense(ctx context.Context, id primitive.ObjectID) (models.ExpensesFetched, error)
+	ListExpenses(ctx context.Context, q ExpenseQuery) (ExpensePage, error)
+	// ExpensesBetween returns expenses added in [from, to], oldest first.
+	ExpensesBetween(ctx context.Context, from, to time.Time) ([]models.ExpensesFetched, error)
+	// ExpensesByMethodBefore is SalesByMethodBefore for expenses added
+	// before t.
+	ExpensesByMethodBefore(ctx context.Context, t time.Time) (map[string]int64, error)
+	ListVoidedExpenses(ctx context.Context) ([]models.ExpensesFetched, error)
+	SetExpenseVoid(ctx context.Context, id primitive.ObjectID, void *models.Void) error
+	ReplaceExpense(ctx context.Context, id primitive.ObjectID, expense models.ExpensesFetched) error
+}
+
+// PeriodAnalyticsStore holds the daily, weekly, monthly and yearly
+// AnalyticsSummary rollups, keyed by period and date range.
+type PeriodAnalyticsStore interface {
+	FindPeriod(ctx context.Context, period string, startDate, endDate time.Time) (models.AnalyticsSummary, error)
+	ListPeriods(ctx context.Context, period string) ([]models.AnalyticsSummary, error)
+	// PeriodsBetween returns the rollups starting in [from, to], oldest
+	// first.
+	PeriodsBetween(ctx context.Context, period string, from, to time.Time) ([]models.AnalyticsSummary, error)
+	IncrementPeriod(ctx context.Context, period string, startDate, endDate time.Time, delta models.AnalyticsDelta) error
+	DeletePeriod(ctx context.Context, period string, startDate, endDate time.Time) error
+	// ClearPeriods deletes every rollup of period.
+	ClearPeriods(ctx context.Context, period string) error
+}
+
+// DailyAnalysisStore holds the per-day DailyData documents that combine
+// sales and operating expenses.
+type DailyAnalysisStore interface {
+	FindDay(ctx context.Context, date time.Time) (models.DailyData, error)
+	ListDays(ctx context.Context) ([]models.DailyData, error)
+	// DaysBetween returns the days dated in [from, to], oldest first.
+	DaysBetween(ctx context.Context, from, to time.Time) ([]models.DailyData, error)
+	IncrementDay(ctx context.Context, date time.Time, delta models.AnalyticsDelta) error
+	DeleteDay(ctx context.Context, id primitive.ObjectID) error
+	DeleteDayByDate(ctx context.Context, date time.Time) error
+}
+
+// AnomalyStore holds what the anomaly detector flagged, one anomaly per
+// Key.
+type AnomalyStore interface {
+	// UpsertAnomaly stores a under its Key. An anomaly already stored
+	// keeps its ID, DetectedAt and acknowledgement; the rest is replaced.
+	UpsertAnomaly(ctx context.Context, a models.Anomaly) error
+	// ResolveAnomaly removes the anomaly with key, if there is one, once
+	// what it flagged is no longer unusual.
+	ResolveAnomaly(ctx context.Context, key string) error
+	// ListAnomalies returns matching anomalies, most recently detected
+	// first.
+	ListAnomalies(ctx context.Context, q AnomalyQuery) ([]models.Anomaly, error)
+	AcknowledgeAnomaly(ctx context.Context, id primitive.ObjectID, at time.Time) error
+}
+
+// Indexer is implemented by backends that need indexes declared before
+// serving requests.
+type Indexer interface {
+	EnsureIndexes(ctx context.Context) error
+}
+
+// Settings is implemented by backends whose data outlives the process. It
+// keeps small named values next to the data they describe, such as the
+// calendar the rollups were built with.
+type Settings interface {
+	// GetSetting returns ErrNotFound for a setting never stored.
+	GetSetting(ctx context.Context, name string) (string, error)
+	PutSetting(ctx context.Context, name, value string) error
+}
+
+// validPeriod checks a rollup period name. Which periods exist is the
+// handlers' configuration; stores only need a name that is safe to key on.
+func validPeriod(period string) error {
+	if period == "" {
+		return fmt.Errorf("invalid period: empty name")
+	}
+	for _, r := range period {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return fmt.Errorf("invalid period: %s", period)
+		}
+	}
+	return nil
+}
+
+// addItems applies per-item deltas. The name follows the latest delta so a
+// renamed item shows its current name.
+func addItems(dst map[string]models.ItemStats, src map[string]models.ItemDelta) {
+	for key, d := range src {
+		stats := dst[key]
+		if d.Name != "" {
+			stats.Name = d.Name
+		}
+		stats.Quantity += d.Quantity
+		stats.Revenue = stats.Revenue.Add(models.NewMoney(d.Revenue))
+		stats.Cost = stats.Cost.Add(models.NewMoney(d.Cost))
+		stats.Margin = stats.Revenue.Sub(stats.Cost)
+		dst[key] = stats
+	}
+}
+
+func addCounts[D, S int | int64](dst map[string]D, src map[string]S) {
+	for key, value := range src {
+		if key == "" || value == 0 {
+			continue
+		}
+		dst[key] += D(value)
+	}
+}
+
+// addMoney adds cents amounts to a map of Money totals.
+func addMoney(dst map[string]models.Money, src map[string]int64) {
+	for key, value := range src {
+		if key == "" || value == 0 {
+			continue
+		}
+		dst[key] = dst[key].Add(models.NewMoney(value))
+	}
+}
+
+func copyCounts[V any](counts map[string]V) map[string]V {
+	out := make(map[string]V, len(counts))
+	for key, value := range counts {
+		out[key] = value
+	}
+	return out
+}
+
+// summariesBetween picks the rollups starting in [from, to] out of a
+// newest-first listing and returns them oldest first.
+func summariesBetween(all []models.AnalyticsSummary, from, to time.Time) []models.AnalyticsSummary {
+	var summaries []models.AnalyticsSummary
+	for i := len(all) - 1; i >= 0; i-- {
+		if !all[i].StartDate.Before(from) && !all[i].StartDate.After(to) {
+			summaries = append(summaries, all[i])
+		}
+	}
+	return summaries
+}
@@ -0,0 +1,364 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tacohut/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The suite below runs against every backend that needs no server.
+
+func TestMemoryStore(t *testing.T) {
+	runStoreSuite(t, func(t *testing.T) Store {
+		return NewMemoryStore()
+	})
+}
+
+func TestBoltStore(t *testing.T) {
+	runStoreSuite(t, func(t *testing.T) Store {
+		s, err := OpenBolt(filepath.Join(t.TempDir(), "tacohut.db"))
+		if err != nil {
+			t.Fatalf("OpenBolt: %v", err)
+		}
+		t.Cleanup(func() { s.Close(context.Background()) })
+		return s
+	})
+}
+
+func runStoreSuite(t *testing.T, open func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s Store)
+	}{
+		{"InsertFindSale", testInsertFindSale},
+		{"VoidRestoreSale", testVoidRestoreSale},
+		{"SalesBetween", testSalesBetween},
+		{"SalesByMethodBefore", testSalesByMethodBefore},
+		{"VoidRestoreExpense", testVoidRestoreExpense},
+		{"IncrementPeriod", testIncrementPeriod},
+		{"ClearPeriods", testClearPeriods},
+		{"DaysBetween", testDaysBetween},
+		{"TransactionRollback", testTransactionRollback},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, open(t))
+		})
+	}
+}
+
+var suiteDay = time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+
+func testSale(at time.Time, method string, cents int64) models.SalesData {
+	return models.SalesData{
+		Items: []models.MenuItem{
+			{MenuItemId: "al-pastor", Name: "Al Pastor", Quantity: 1, Price: models.NewMoney(cents), Cost: models.NewMoney(cents / 4), Time: at},
+		},
+		PaymentMethod: method,
+		Total:         models.NewMoney(cents),
+		RecordedAt:    at,
+	}
+}
+
+func insertSale(t *testing.T, s Store, sale models.SalesData) primitive.ObjectID {
+	t.Helper()
+	id, err := s.Sales().InsertSale(context.Background(), sale)
+	if err != nil {
+		t.Fatalf("InsertSale: %v", err)
+	}
+	return id
+}
+
+func testInsertFindSale(t *testing.T, s Store) {
+	ctx := context.Background()
+	sale := testSale(suiteDay.Add(12*time.Hour), "cash", 1250)
+	id := insertSale(t, s, sale)
+
+	got, err := s.Sales().FindSale(ctx, id)
+	if err != nil {
+		t.Fatalf("FindSale: %v", err)
+	}
+	if got.ID != id {
+		t.Errorf("ID = %v, want %v", got.ID, id)
+	}
+	if got.Total != sale.Total || got.PaymentMethod != "cash" || !got.RecordedAt.Equal(sale.RecordedAt) {
+		t.Errorf("FindSale = %+v, want %+v", got, sale)
+	}
+	if len(got.Items) != 1 || got.Items[0].Price != sale.Items[0].Price {
+		t.Errorf("Items = %+v, want %+v", got.Items, sale.Items)
+	}
+
+	if _, err := s.Sales().FindSale(ctx, primitive.NewObjectID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindSale of unknown id: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testVoidRestoreSale(t *testing.T, s Store) {
+	ctx := context.Background()
+	id := insertSale(t, s, testSale(suiteDay.Add(12*time.Hour), "cash", 1000))
+	insertSale(t, s, testSale(suiteDay.Add(13*time.Hour), "card", 500))
+
+	void := &models.Void{VoidedAt: suiteDay.Add(14 * time.Hour), VoidedBy: "manager", Reason: "mistake"}
+	if err := s.Sales().SetSaleVoid(ctx, id, void); err != nil {
+		t.Fatalf("SetSaleVoid: %v", err)
+	}
+
+	page, err := s.Sales().ListSales(ctx, SalesQuery{})
+	if err != nil {
+		t.Fatalf("ListSales: %v", err)
+	}
+	if page.Total != 1 || len(page.Sales) != 1 {
+		t.Errorf("ListSales after void: %d sales, want 1", page.Total)
+	}
+	trash, err := s.Sales().ListVoidedSales(ctx)
+	if err != nil {
+		t.Fatalf("ListVoidedSales: %v", err)
+	}
+	if len(trash) != 1 || trash[0].ID != id || trash[0].Voided.Reason != "mistake" {
+		t.Errorf("ListVoidedSales = %+v, want the voided sale", trash)
+	}
+
+	if err := s.Sales().SetSaleVoid(ctx, id, nil); err != nil {
+		t.Fatalf("SetSaleVoid(nil): %v", err)
+	}
+	page, err = s.Sales().ListSales(ctx, SalesQuery{})
+	if err != nil {
+		t.Fatalf("ListSales: %v", err)
+	}
+	if page.Total != 2 {
+		t.Errorf("ListSales after restore: %d sales, want 2", page.Total)
+	}
+
+	if err := s.Sales().SetSaleVoid(ctx, primitive.NewObjectID(), void); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetSaleVoid of unknown id: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testSalesBetween(t *testing.T, s Store) {
+	ctx := context.Background()
+	insertSale(t, s, testSale(suiteDay.Add(-time.Hour), "cash", 100))
+	insertSale(t, s, testSale(suiteDay.Add(20*time.Hour), "cash", 300))
+	insertSale(t, s, testSale(suiteDay, "cash", 200))
+	voided := insertSale(t, s, testSale(suiteDay.Add(time.Hour), "cash", 900))
+	insertSale(t, s, testSale(suiteDay.Add(24*time.Hour), "cash", 400))
+
+	if err := s.Sales().SetSaleVoid(ctx, voided, &models.Void{VoidedAt: suiteDay}); err != nil {
+		t.Fatalf("SetSaleVoid: %v", err)
+	}
+
+	sales, err := s.Sales().SalesBetween(ctx, suiteDay, suiteDay.Add(24*time.Hour-time.Nanosecond))
+	if err != nil {
+		t.Fatalf("SalesBetween: %v", err)
+	}
+	var got []int64
+	for _, sale := range sales {
+		got = append(got, sale.Total.Cents)
+	}
+	if len(got) != 2 || got[0] != 200 || got[1] != 300 {
+		t.Errorf("SalesBetween totals = %v, want [200 300]", got)
+	}
+}
+
+func testSalesByMethodBefore(t *testing.T, s Store) {
+	ctx := context.Background()
+	insertSale(t, s, testSale(suiteDay.Add(-2*time.Hour), "cash", 100))
+	insertSale(t, s, testSale(suiteDay.Add(-time.Hour), "cash", 250))
+	insertSale(t, s, testSale(suiteDay.Add(-time.Hour), "card", 400))
+	insertSale(t, s, testSale(suiteDay, "cash", 800))
+
+	totals, err := s.Sales().SalesByMethodBefore(ctx, suiteDay)
+	if err != nil {
+		t.Fatalf("SalesByMethodBefore: %v", err)
+	}
+	if len(totals) != 2 || totals["cash"] != 350 || totals["card"] != 400 {
+		t.Errorf("SalesByMethodBefore = %v, want cash 350, card 400", totals)
+	}
+}
+
+func testVoidRestoreExpense(t *testing.T, s Store) {
+	ctx := context.Background()
+	id, err := s.Expenses().InsertExpense(ctx, models.Expenses{
+		Amount:        models.NewMoney(4550),
+		Category:      "supplies",
+		PaymentMethod: "cash",
+		TimeAdded:     suiteDay.Add(10 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("InsertExpense: %v", err)
+	}
+
+	got, err := s.Expenses().FindExpense(ctx, id)
+	if err != nil {
+		t.Fatalf("FindExpense: %v", err)
+	}
+	if got.Amount.Cents != 4550 || got.Category != "supplies" {
+		t.Errorf("FindExpense = %+v", got)
+	}
+
+	if err := s.Expenses().SetExpenseVoid(ctx, id, &models.Void{VoidedAt: suiteDay}); err != nil {
+		t.Fatalf("SetExpenseVoid: %v", err)
+	}
+	expenses, err := s.Expenses().ExpensesBetween(ctx, suiteDay, suiteDay.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("ExpensesBetween: %v", err)
+	}
+	if len(expenses) != 0 {
+		t.Errorf("ExpensesBetween after void: %d expenses, want 0", len(expenses))
+	}
+
+	if err := s.Expenses().SetExpenseVoid(ctx, id, nil); err != nil {
+		t.Fatalf("SetExpenseVoid(nil): %v", err)
+	}
+	expenses, err = s.Expenses().ExpensesBetween(ctx, suiteDay, suiteDay.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("ExpensesBetween: %v", err)
+	}
+	if len(expenses) != 1 {
+		t.Errorf("ExpensesBetween after restore: %d expenses, want 1", len(expenses))
+	}
+}
+
+func testIncrementPeriod(t *testing.T, s Store) {
+	ctx := context.Background()
+	start, end := suiteDay, suiteDay.Add(24*time.Hour-time.Nanosecond)
+	delta := models.AnalyticsDelta{
+		ItemsSold:        map[string]int{"Al Pastor": 2},
+		Items:            map[string]models.ItemDelta{"al-pastor": {Name: "Al Pastor", Quantity: 2, Revenue: 900, Cost: 300}},
+		PaymentMethods:   map[string]int64{"cash": 900},
+		TotalSales:       900,
+		TotalExpenses:    300,
+		CostOfGoods:      300,
+		TransactionCount: 1,
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.Periods().IncrementPeriod(ctx, "daily", start, end, delta); err != nil {
+			t.Fatalf("IncrementPeriod: %v", err)
+		}
+	}
+
+	got, err := s.Periods().FindPeriod(ctx, "daily", start, end)
+	if err != nil {
+		t.Fatalf("FindPeriod: %v", err)
+	}
+	if got.TotalSales.Cents != 1800 || got.TransactionCount != 2 || got.ItemsSold["Al Pastor"] != 4 {
+		t.Errorf("rollup = sales %d, transactions %d, items %v; want 1800, 2, 4",
+			got.TotalSales.Cents, got.TransactionCount, got.ItemsSold)
+	}
+	if got.GrossProfit.Cents != 1200 || got.NetProfit.Cents != 1200 {
+		t.Errorf("profits = gross %d, net %d; want 1200, 1200", got.GrossProfit.Cents, got.NetProfit.Cents)
+	}
+	if item := got.Items["al-pastor"]; item.Quantity != 4 || item.Margin.Cents != 1200 {
+		t.Errorf("item = %+v, want quantity 4, margin 1200", item)
+	}
+	if got.PaymentMethods["cash"].Cents != 1800 {
+		t.Errorf("paymentMethods = %v, want cash 1800", got.PaymentMethods)
+	}
+
+	summaries, err := s.Periods().PeriodsBetween(ctx, "daily", start, end)
+	if err != nil {
+		t.Fatalf("PeriodsBetween: %v", err)
+	}
+	if len(summaries) != 1 {
+		t.Errorf("PeriodsBetween: %d rollups, want 1", len(summaries))
+	}
+}
+
+func testClearPeriods(t *testing.T, s Store) {
+	ctx := context.Background()
+	delta := models.AnalyticsDelta{TotalSales: 900, TransactionCount: 1}
+	for i := 0; i < 3; i++ {
+		start := suiteDay.AddDate(0, 0, i)
+		if err := s.Periods().IncrementPeriod(ctx, "daily", start, start.Add(24*time.Hour-time.Nanosecond), delta); err != nil {
+			t.Fatalf("IncrementPeriod: %v", err)
+		}
+	}
+	weekEnd := suiteDay.AddDate(0, 0, 7).Add(-time.Nanosecond)
+	if err := s.Periods().IncrementPeriod(ctx, "weekly", suiteDay, weekEnd, delta); err != nil {
+		t.Fatalf("IncrementPeriod: %v", err)
+	}
+
+	if err := s.Periods().ClearPeriods(ctx, "daily"); err != nil {
+		t.Fatalf("ClearPeriods: %v", err)
+	}
+
+	if days, err := s.Periods().ListPeriods(ctx, "daily"); err != nil || len(days) != 0 {
+		t.Errorf("daily after ClearPeriods = %d rollups, %v; want none", len(days), err)
+	}
+	if weeks, err := s.Periods().ListPeriods(ctx, "weekly"); err != nil || len(weeks) != 1 {
+		t.Errorf("weekly after clearing daily = %d rollups, %v; want 1", len(weeks), err)
+	}
+}
+
+func testDaysBetween(t *testing.T, s Store) {
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		delta := models.AnalyticsDelta{TotalSales: int64(100 * (i + 1)), TransactionCount: 1}
+		if err := s.Daily().IncrementDay(ctx, suiteDay.AddDate(0, 0, i), delta); err != nil {
+			t.Fatalf("IncrementDay: %v", err)
+		}
+	}
+
+	days, err := s.Daily().DaysBetween(ctx, suiteDay.AddDate(0, 0, 1), suiteDay.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatalf("DaysBetween: %v", err)
+	}
+	var got []int64
+	for _, day := range days {
+		got = append(got, day.TotalSales.Cents)
+	}
+	if len(got) != 3 || got[0] != 200 || got[1] != 300 || got[2] != 400 {
+		t.Errorf("DaysBetween totals = %v, want [200 300 400]", got)
+	}
+}
+
+func testTransactionRollback(t *testing.T, s Store) {
+	ctx := context.Background()
+	start, end := suiteDay, suiteDay.Add(24*time.Hour-time.Nanosecond)
+	failed := errors.New("failed")
+
+	err := s.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.Sales().InsertSale(ctx, testSale(suiteDay.Add(time.Hour), "cash", 700)); err != nil {
+			return err
+		}
+		if err := s.Periods().IncrementPeriod(ctx, "daily", start, end, models.AnalyticsDelta{TotalSales: 700, TransactionCount: 1}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("RunInTransaction: err = %v, want %v", err, failed)
+	}
+
+	page, err := s.Sales().ListSales(ctx, SalesQuery{})
+	if err != nil {
+		t.Fatalf("ListSales: %v", err)
+	}
+	if page.Total != 0 {
+		t.Errorf("sale kept after rollback")
+	}
+	if _, err := s.Periods().FindPeriod(ctx, "daily", start, end); !errors.Is(err, ErrNotFound) {
+		t.Errorf("rollup kept after rollback: err = %v", err)
+	}
+
+	err = s.RunInTransaction(ctx, func(ctx context.Context) error {
+		_, err := s.Sales().InsertSale(ctx, testSale(suiteDay.Add(time.Hour), "cash", 700))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("RunInTransaction: %v", err)
+	}
+	page, err = s.Sales().ListSales(ctx, SalesQuery{})
+	if err != nil {
+		t.Fatalf("ListSales: %v", err)
+	}
+	if page.Total != 1 {
+		t.Errorf("ListSales after commit: %d sales, want 1", page.Total)
+	}
+}
@@ -5,6 +5,7 @@ import { useSales } from '../context/SalesContext'
 interface SaleItem {
   menuItemId: string
   name: string
+  category: string
   quantity: number
   price: number
   cost: number
@@ -31,6 +32,7 @@ export default function AddSale() {
       setCart([...cart, {
         menuItemId: menuItem.id,
         name: menuItem.name,
+        category: menuItem.category,
         quantity: 1,
         price: menuItem.price,
         cost: menuItem.cost,
@@ -19,6 +19,7 @@ export interface Sale {
 export interface SaleItem {
   menuItemId: string
   name: string
+  category?: string
   quantity: number
   price: number
   cost: number